@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+)
+
+func runQueue(a *app, args []string) error {
+	return runSubcommand(a, "queue", args, []command{
+		{"create", "create a queue", queueCreate},
+		{"delete", "delete a queue", queueDelete},
+		{"list", "list queues with their roles", queueList},
+	})
+}
+
+func runRole(a *app, args []string) error {
+	return runSubcommand(a, "role", args, []command{
+		{"create", "create publisher or consumer roles", roleCreate},
+		{"delete", "delete a role", roleDelete},
+	})
+}
+
+func queueCreate(a *app, args []string) error {
+	fs := newFlagSet(a, "queue create", "NAME")
+	pushType := fs.String("type", "Direct", "push type: Direct or Fanout")
+	qos := fs.String("qos", "Yes", "whether consumers must ack messages: Yes or No")
+	remark := fs.String("remark", "", "remark of the queue")
+	coupon := fs.String("coupon", "", "coupon ID")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	client, err := a.umqClient()
+	if err != nil {
+		return err
+	}
+	id, err := client.CreateQueue(a.conf.ProjectID, *coupon, *remark, fs.Arg(0), *pushType, *qos)
+	if err != nil {
+		return err
+	}
+	queueID := fmt.Sprint(id)
+	return a.print(result{
+		value:   map[string]string{"QueueId": queueID},
+		headers: []string{"QUEUE ID"},
+		rows:    [][]string{{queueID}},
+	})
+}
+
+func queueDelete(a *app, args []string) error {
+	fs := newFlagSet(a, "queue delete", "QUEUE_ID")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	client, err := a.umqClient()
+	if err != nil {
+		return err
+	}
+	id, err := client.DeleteQueue(fs.Arg(0), a.conf.ProjectID)
+	if err != nil {
+		return err
+	}
+	queueID := fmt.Sprint(id)
+	return a.print(result{
+		value:   map[string]string{"QueueId": queueID},
+		headers: []string{"DELETED QUEUE ID"},
+		rows:    [][]string{{queueID}},
+	})
+}
+
+func queueList(a *app, args []string) error {
+	fs := newFlagSet(a, "queue list", "")
+	limit := fs.Int("limit", 100, "maximum number of queues")
+	offset := fs.Int("offset", 0, "offset of the first queue")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	client, err := a.umqClient()
+	if err != nil {
+		return err
+	}
+	res, err := client.ListQueue(*limit, *offset, a.conf.ProjectID)
+	if err != nil {
+		return err
+	}
+	queues, _ := res.([]umq.QueueInfo)
+	if queues == nil {
+		queues = []umq.QueueInfo{}
+	}
+
+	rows := make([][]string, 0, len(queues))
+	for _, q := range queues {
+		rows = append(rows, []string{
+			q.QueueId, q.QueueName, q.PushType, strconv.Itoa(q.MsgTTL),
+			strconv.Itoa(len(q.PublisherList)), strconv.Itoa(len(q.ConsumerList)),
+			formatUnix(q.CreateTime),
+		})
+	}
+	return a.print(result{
+		value:   queues,
+		headers: []string{"QUEUE ID", "NAME", "PUSH TYPE", "MSG TTL", "PUBLISHERS", "CONSUMERS", "CREATED"},
+		rows:    rows,
+	})
+}
+
+func roleCreate(a *app, args []string) error {
+	fs := newFlagSet(a, "role create", "QUEUE_ID Pub|Sub")
+	num := fs.Int("num", 1, "number of roles to create")
+	if err := parseFlags(fs, args, 2); err != nil {
+		return err
+	}
+
+	client, err := a.umqClient()
+	if err != nil {
+		return err
+	}
+	res, err := client.CreateRole(fs.Arg(0), *num, fs.Arg(1), a.conf.ProjectID)
+	if err != nil {
+		return err
+	}
+	roles, _ := res.([]umq.Role)
+	if roles == nil {
+		roles = []umq.Role{}
+	}
+	return a.print(rolesResult(roles))
+}
+
+func roleDelete(a *app, args []string) error {
+	fs := newFlagSet(a, "role delete", "QUEUE_ID Pub|Sub ROLE_ID")
+	if err := parseFlags(fs, args, 3); err != nil {
+		return err
+	}
+
+	client, err := a.umqClient()
+	if err != nil {
+		return err
+	}
+	id, err := client.DeleteRole(fs.Arg(0), fs.Arg(2), fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	roleID := fmt.Sprint(id)
+	return a.print(result{
+		value:   map[string]string{"RoleId": roleID},
+		headers: []string{"DELETED ROLE ID"},
+		rows:    [][]string{{roleID}},
+	})
+}
+
+func rolesResult(roles []umq.Role) result {
+	rows := make([][]string, 0, len(roles))
+	for _, r := range roles {
+		rows = append(rows, []string{r.Id, r.Token, formatUnix(r.CreateTime)})
+	}
+	return result{
+		value:   roles,
+		headers: []string{"ROLE ID", "TOKEN", "CREATED"},
+		rows:    rows,
+	}
+}
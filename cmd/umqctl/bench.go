@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/ucloud/umq-sdk-go/umq/umqbench"
+)
+
+func runBench(a *app, args []string) error {
+	fs := newFlagSet(a, "bench", "")
+	queueID := fs.String("queue", a.conf.QueueID, "queue ID")
+	producerID := fs.String("producer-id", a.conf.ProducerID, "producer ID")
+	producerToken := fs.String("producer-token", a.conf.ProducerToken, "producer token")
+	consumerID := fs.String("consumer-id", a.conf.ConsumerID, "consumer ID")
+	consumerToken := fs.String("consumer-token", a.conf.ConsumerToken, "consumer token")
+	producers := fs.Int("producers", 1, "number of concurrent producers")
+	consumers := fs.Int("consumers", 1, "number of concurrent consumers (0 to only publish)")
+	messages := fs.Int("messages", 1000, "total messages to publish (0 to publish for -duration)")
+	duration := fs.Duration("duration", 0, "how long to publish")
+	rate := fs.Float64("rate", 0, "maximum messages per second across all producers (0 for unlimited)")
+	size := fs.Int("size", umqbench.DefaultPayloadSize, "message size in bytes")
+	drain := fs.Duration("drain", umqbench.DefaultDrainTimeout, "how long to wait for consumers after publishing")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if *queueID == "" || *producerID == "" || *producerToken == "" ||
+		*consumers > 0 && (*consumerID == "" || *consumerToken == "") {
+		fmt.Fprintln(a.stderr, "umqctl bench: -queue and producer credentials are required, plus consumer credentials when -consumers > 0")
+		return errUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	res, err := umqbench.Run(ctx, umqbench.Options{
+		Config:        a.conf.umqConfig(),
+		QueueID:       *queueID,
+		ProducerID:    *producerID,
+		ProducerToken: *producerToken,
+		ConsumerID:    *consumerID,
+		ConsumerToken: *consumerToken,
+		Producers:     *producers,
+		Consumers:     *consumers,
+		Messages:      *messages,
+		Duration:      *duration,
+		Rate:          *rate,
+		PayloadSize:   *size,
+		DrainTimeout:  *drain,
+	})
+	if err != nil {
+		return err
+	}
+
+	count := func(n int64) string { return strconv.FormatInt(n, 10) }
+	perSecond := func(r float64) string { return strconv.FormatFloat(r, 'f', 1, 64) + "/s" }
+	latency := func(l umqbench.Latency) string {
+		return fmt.Sprintf("p50=%v p95=%v p99=%v max=%v", round(l.P50), round(l.P95), round(l.P99), round(l.Max))
+	}
+	return a.print(result{
+		value:   res,
+		headers: []string{"METRIC", "VALUE"},
+		rows: [][]string{
+			{"queue", res.QueueId},
+			{"producers/consumers", fmt.Sprintf("%d/%d", res.Producers, res.Consumers)},
+			{"duration", round(res.Duration).String()},
+			{"published", count(res.Published)},
+			{"publish errors", count(res.PublishErrors)},
+			{"publish rate", perSecond(res.PublishRate)},
+			{"publish latency", latency(res.PublishLatency)},
+			{"received", count(res.Received)},
+			{"duplicates", count(res.Duplicates)},
+			{"lost", count(res.Lost)},
+			{"ack errors", count(res.AckErrors)},
+			{"reconnects", count(res.Reconnects)},
+			{"consume rate", perSecond(res.ConsumeRate)},
+			{"end-to-end latency", latency(res.EndToEndLatency)},
+		},
+	})
+}
+
+// round 使表格中的时间保留合适的精度
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	default:
+		return d.Round(time.Microsecond)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+)
+
+// Configuration 与conf.json.template的格式一致，额外支持显式指定接入点
+type Configuration struct {
+	// Host 就是队列所在的URL
+	Host string
+	// 账户的公钥
+	PublicKey string
+	// 账户的私钥
+	PrivateKey string
+	// 地域，参考 https://docs.ucloud.cn/api/summary/regionlist
+	Region string
+	// 账户名
+	Account string
+	// 项目ID，类似 org-0ex02v
+	ProjectID string
+	// 生产者ID
+	ProducerID string
+	// 生产者Token
+	ProducerToken string
+	// 消费者ID
+	ConsumerID string
+	// 消费者Token
+	ConsumerToken string
+	// queue ID
+	QueueID string
+
+	// 以下为可选项，对应umq.UmqConfig的同名字段
+	HTTPURL      string `json:",omitempty"`
+	WebsocketURL string `json:",omitempty"`
+	APIURL       string `json:",omitempty"`
+	UseTLS       bool   `json:",omitempty"`
+	HTTPMethod   string `json:",omitempty"`
+}
+
+// envVars 环境变量与配置字段的对应关系，环境变量优先于配置文件
+var envVars = []struct {
+	name  string
+	field func(*Configuration) *string
+}{
+	{"UMQ_HOST", func(c *Configuration) *string { return &c.Host }},
+	{"UMQ_PUBLIC_KEY", func(c *Configuration) *string { return &c.PublicKey }},
+	{"UMQ_PRIVATE_KEY", func(c *Configuration) *string { return &c.PrivateKey }},
+	{"UMQ_REGION", func(c *Configuration) *string { return &c.Region }},
+	{"UMQ_ACCOUNT", func(c *Configuration) *string { return &c.Account }},
+	{"UMQ_PROJECT_ID", func(c *Configuration) *string { return &c.ProjectID }},
+	{"UMQ_PRODUCER_ID", func(c *Configuration) *string { return &c.ProducerID }},
+	{"UMQ_PRODUCER_TOKEN", func(c *Configuration) *string { return &c.ProducerToken }},
+	{"UMQ_CONSUMER_ID", func(c *Configuration) *string { return &c.ConsumerID }},
+	{"UMQ_CONSUMER_TOKEN", func(c *Configuration) *string { return &c.ConsumerToken }},
+	{"UMQ_QUEUE_ID", func(c *Configuration) *string { return &c.QueueID }},
+	{"UMQ_HTTP_URL", func(c *Configuration) *string { return &c.HTTPURL }},
+	{"UMQ_WEBSOCKET_URL", func(c *Configuration) *string { return &c.WebsocketURL }},
+	{"UMQ_API_URL", func(c *Configuration) *string { return &c.APIURL }},
+	{"UMQ_HTTP_METHOD", func(c *Configuration) *string { return &c.HTTPMethod }},
+}
+
+// envBoolVars 布尔类型的配置字段，取值按strconv.ParseBool解析，如1、true、0、false
+var envBoolVars = []struct {
+	name  string
+	field func(*Configuration) *bool
+}{
+	{"UMQ_USE_TLS", func(c *Configuration) *bool { return &c.UseTLS }},
+}
+
+// defaultProfilesPath 命名profile文件的默认位置，可通过UMQ_PROFILES覆盖
+func defaultProfilesPath() string {
+	if path := os.Getenv("UMQ_PROFILES"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".umqctl", "profiles.json")
+}
+
+// loadConfiguration 按以下顺序合并配置，后者覆盖前者:
+//  1. configPath指定的conf.json，或profilesPath中名为profile的配置
+//  2. UMQ_*环境变量
+func loadConfiguration(configPath, profilesPath, profile string) (Configuration, error) {
+	var conf Configuration
+	switch {
+	case configPath != "":
+		if err := readJSON(configPath, &conf); err != nil {
+			return conf, err
+		}
+	case profilesPath != "":
+		profiles := map[string]Configuration{}
+		err := readJSON(profilesPath, &profiles)
+		if errors.Is(err, os.ErrNotExist) && profile == "" {
+			// 未显式指定profile时允许profile文件不存在，仅使用环境变量
+			break
+		}
+		if err != nil {
+			return conf, err
+		}
+		name := profile
+		if name == "" {
+			name = "default"
+		}
+		p, ok := profiles[name]
+		if !ok && profile != "" {
+			return conf, fmt.Errorf("profile %q not found in %s", profile, profilesPath)
+		}
+		conf = p
+	}
+
+	for _, env := range envVars {
+		if v := os.Getenv(env.name); v != "" {
+			*env.field(&conf) = v
+		}
+	}
+	for _, env := range envBoolVars {
+		v := os.Getenv(env.name)
+		if v == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return conf, fmt.Errorf("%s: invalid boolean %q", env.name, v)
+		}
+		*env.field(&conf) = b
+	}
+	return conf, nil
+}
+
+func readJSON(path string, v interface{}) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := json.NewDecoder(file).Decode(v); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// umqConfig 转换为创建client所需的umq.UmqConfig
+func (conf Configuration) umqConfig() umq.UmqConfig {
+	return umq.UmqConfig{
+		Host:         conf.Host,
+		UseTLS:       conf.UseTLS,
+		HTTPURL:      conf.HTTPURL,
+		WebsocketURL: conf.WebsocketURL,
+		APIURL:       conf.APIURL,
+		HTTPMethod:   conf.HTTPMethod,
+		Region:       conf.Region,
+		Account:      conf.Account,
+		ProjectID:    conf.ProjectID,
+		PublicKey:    conf.PublicKey,
+		PrivateKey:   conf.PrivateKey,
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigurationEnvOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conf.json")
+	if err := os.WriteFile(path, []byte(`{"Host":"file","HTTPMethod":"GET","UseTLS":true}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("UMQ_HOST", "env")
+	t.Setenv("UMQ_HTTP_METHOD", "POST")
+	t.Setenv("UMQ_USE_TLS", "false")
+	conf, err := loadConfiguration(path, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Host != "env" || conf.HTTPMethod != "POST" || conf.UseTLS {
+		t.Fatalf("conf = %+v, want environment values", conf)
+	}
+
+	// 未设置的环境变量不覆盖配置文件
+	t.Setenv("UMQ_USE_TLS", "")
+	t.Setenv("UMQ_HTTP_METHOD", "")
+	if conf, err = loadConfiguration(path, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if conf.HTTPMethod != "GET" || !conf.UseTLS {
+		t.Fatalf("conf = %+v, want file values", conf)
+	}
+}
+
+func TestLoadConfigurationInvalidBool(t *testing.T) {
+	t.Setenv("UMQ_USE_TLS", "yes please")
+	if _, err := loadConfiguration("", "", ""); err == nil {
+		t.Fatal("invalid UMQ_USE_TLS accepted")
+	}
+}
@@ -0,0 +1,171 @@
+// umqctl 是UMQ的命令行工具，用于管理队列及角色，以及发布和查看消息
+//
+// 用法:
+//
+//	umqctl [-config conf.json | -profile name] [-o table|json|yaml] <command> [arguments]
+//
+// 凭证可以来自conf.json格式的配置文件、~/.umqctl/profiles.json中的命名profile
+// （profile名到conf.json内容的映射）或UMQ_*环境变量，环境变量优先。
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+)
+
+// app 所有命令共享的状态
+type app struct {
+	conf   Configuration
+	format string
+	stdout io.Writer
+	stderr io.Writer
+	client *umq.UmqClient
+}
+
+// umqClient 首次调用时根据配置创建client
+func (a *app) umqClient() (*umq.UmqClient, error) {
+	if a.client != nil {
+		return a.client, nil
+	}
+	client, err := umq.CreateClient(a.conf.umqConfig())
+	if err != nil {
+		return nil, err
+	}
+	a.client = client
+	return client, nil
+}
+
+func (a *app) print(res result) error {
+	return writeResult(a.stdout, a.format, res)
+}
+
+// command 一个子命令，run收到的args不包含命令名本身
+type command struct {
+	name    string
+	summary string
+	run     func(a *app, args []string) error
+}
+
+// errUsage 参数错误，usage已输出
+var errUsage = errors.New("usage error")
+
+func commands() []command {
+	return []command{
+		{"queue", "create, delete or list queues", runQueue},
+		{"role", "create or delete publisher/consumer roles", runRole},
+		{"publish", "publish messages from arguments, stdin or a file", runPublish},
+		{"tail", "print messages from a queue as they arrive", runTail},
+		{"consume", "alias for tail", runTail},
+		{"bench", "measure end-to-end throughput and latency", runBench},
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("umqctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "", "path to a conf.json style configuration file")
+	profile := fs.String("profile", os.Getenv("UMQ_PROFILE"), "named profile in the profiles file")
+	profilesPath := fs.String("profiles", defaultProfilesPath(), "path to the profiles file")
+	format := fs.String("o", formatTable, "output format: table, json or yaml")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: umqctl [flags] <command> [arguments]")
+		fmt.Fprintln(stderr, "\ncommands:")
+		for _, cmd := range commands() {
+			fmt.Fprintf(stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+		}
+		fmt.Fprintln(stderr, "\nflags:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if err := checkFormat(*format); err != nil {
+		fmt.Fprintln(stderr, "umqctl:", err)
+		return 2
+	}
+
+	conf, err := loadConfiguration(*configPath, *profilesPath, *profile)
+	if err != nil {
+		fmt.Fprintln(stderr, "umqctl:", err)
+		return 1
+	}
+	a := &app{conf: conf, format: *format, stdout: stdout, stderr: stderr}
+
+	name := fs.Arg(0)
+	for _, cmd := range commands() {
+		if cmd.name != name {
+			continue
+		}
+		err := cmd.run(a, fs.Args()[1:])
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, errUsage):
+			return 2
+		default:
+			fmt.Fprintf(stderr, "umqctl %s: %v\n", name, err)
+			return 1
+		}
+	}
+	fmt.Fprintf(stderr, "umqctl: unknown command %q\n", name)
+	fs.Usage()
+	return 2
+}
+
+// runSubcommand 分发queue、role等命令组的子命令
+func runSubcommand(a *app, group string, args []string, subs []command) error {
+	usage := func() {
+		fmt.Fprintf(a.stderr, "usage: umqctl %s <subcommand> [arguments]\n\nsubcommands:\n", group)
+		for _, sub := range subs {
+			fmt.Fprintf(a.stderr, "  %-10s %s\n", sub.name, sub.summary)
+		}
+	}
+	if len(args) == 0 {
+		usage()
+		return errUsage
+	}
+	for _, sub := range subs {
+		if sub.name == args[0] {
+			return sub.run(a, args[1:])
+		}
+	}
+	fmt.Fprintf(a.stderr, "umqctl %s: unknown subcommand %q\n", group, args[0])
+	usage()
+	return errUsage
+}
+
+// newFlagSet 创建子命令的FlagSet，错误输出到stderr
+func newFlagSet(a *app, name, argsUsage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "usage: umqctl %s [flags] %s\n", name, argsUsage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags 解析参数并检查位置参数的个数，nargs<0时不限制个数
+func parseFlags(fs *flag.FlagSet, args []string, nargs int) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if nargs >= 0 && fs.NArg() != nargs {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		args  []string
+		nargs int
+		ok    bool
+	}{
+		{[]string{"-n", "1", "a"}, 1, true},
+		{[]string{"a", "b"}, 1, false},
+		{nil, 0, true},
+		{[]string{"-unknown"}, 0, false},
+		{[]string{"a", "b", "c"}, -1, true},
+		{nil, -1, true},
+		{[]string{"-unknown", "a"}, -1, false},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		fs.Int("n", 0, "")
+		err := parseFlags(fs, tt.args, tt.nargs)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseFlags(%q, %d) = %v", tt.args, tt.nargs, err)
+		}
+		if err != nil && err != errUsage {
+			t.Errorf("parseFlags(%q, %d) = %v, want errUsage", tt.args, tt.nargs, err)
+		}
+	}
+}
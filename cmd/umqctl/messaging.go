@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+)
+
+// maxLineSize 从stdin或文件按行读取消息时单条消息的最大长度
+const maxLineSize = 4 << 20
+
+// unsubscribeWait tail退出时等待订阅结束的最长时间
+const unsubscribeWait = 2 * time.Second
+
+// messageSource 依次返回待发布的消息，没有更多消息时返回io.EOF
+type messageSource func() (string, error)
+
+// argsSource 循环发送命令行参数，count为0时每个参数发送一次
+func argsSource(args []string, count int) messageSource {
+	total := count
+	if total == 0 {
+		total = len(args)
+	}
+	i := 0
+	return func() (string, error) {
+		if i >= total {
+			return "", io.EOF
+		}
+		msg := args[i%len(args)]
+		i++
+		return msg, nil
+	}
+}
+
+// linesSource 每行作为一条消息，忽略空行
+func linesSource(r io.Reader, count int) messageSource {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	sent := 0
+	return func() (string, error) {
+		for count == 0 || sent < count {
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return "", err
+				}
+				return "", io.EOF
+			}
+			if line := scanner.Text(); line != "" {
+				sent++
+				return line, nil
+			}
+		}
+		return "", io.EOF
+	}
+}
+
+// rawSource 整个输入作为一条消息，count大于1时重复发送
+func rawSource(r io.Reader, count int) (messageSource, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return argsSource([]string{string(buf)}, count), nil
+}
+
+// publishSummary publish命令的输出
+type publishSummary struct {
+	QueueId   string
+	Published int
+	Failed    int
+	Duration  string
+	Rate      float64
+	LastError string `json:",omitempty"`
+}
+
+func runPublish(a *app, args []string) error {
+	fs := newFlagSet(a, "publish", "[MESSAGE...]")
+	queueID := fs.String("queue", a.conf.QueueID, "queue ID")
+	producerID := fs.String("producer-id", a.conf.ProducerID, "producer ID")
+	producerToken := fs.String("producer-token", a.conf.ProducerToken, "producer token")
+	file := fs.String("file", "", "read messages from `path`, one per line (- for stdin); stdin is used when no MESSAGE is given")
+	raw := fs.Bool("raw", false, "send the whole file or stdin as a single message instead of one per line")
+	count := fs.Int("count", 0, "number of messages to send; MESSAGE arguments are repeated cyclically (0 sends each input once)")
+	rate := fs.Float64("rate", 0, "maximum messages per second (0 for unlimited)")
+	if err := parseFlags(fs, args, -1); err != nil {
+		return err
+	}
+	if *queueID == "" || *producerID == "" || *producerToken == "" {
+		fmt.Fprintln(a.stderr, "umqctl publish: -queue, -producer-id and -producer-token are required (or QueueID, ProducerID and ProducerToken in the configuration)")
+		return errUsage
+	}
+
+	var (
+		next messageSource
+		err  error
+	)
+	if fs.NArg() > 0 {
+		if *file != "" {
+			fmt.Fprintln(a.stderr, "umqctl publish: MESSAGE arguments and -file are mutually exclusive")
+			return errUsage
+		}
+		next = argsSource(fs.Args(), *count)
+	} else {
+		var in io.Reader = os.Stdin
+		if *file != "" && *file != "-" {
+			f, err := os.Open(*file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		if *raw {
+			next, err = rawSource(in, *count)
+			if err != nil {
+				return err
+			}
+		} else {
+			next = linesSource(in, *count)
+		}
+	}
+
+	client, err := a.umqClient()
+	if err != nil {
+		return err
+	}
+	producer := client.NewProducer(*producerID, *producerToken)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var tick <-chan time.Time
+	if *rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / *rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	summary := publishSummary{QueueId: *queueID}
+	var lastErr error
+	start := time.Now()
+	for ctx.Err() == nil {
+		msg, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if tick != nil && summary.Published+summary.Failed > 0 {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				continue
+			}
+		}
+		if err := producer.PublishMsgContext(ctx, *queueID, msg); err != nil {
+			summary.Failed++
+			lastErr = err
+			fmt.Fprintln(a.stderr, "umqctl publish:", err)
+			continue
+		}
+		summary.Published++
+	}
+	elapsed := time.Since(start)
+	summary.Duration = elapsed.Round(time.Millisecond).String()
+	if elapsed > 0 {
+		summary.Rate = float64(summary.Published) / elapsed.Seconds()
+	}
+	if lastErr != nil {
+		summary.LastError = lastErr.Error()
+	}
+
+	err = a.print(result{
+		value:   summary,
+		headers: []string{"QUEUE ID", "PUBLISHED", "FAILED", "DURATION", "RATE/S"},
+		rows: [][]string{{
+			summary.QueueId, strconv.Itoa(summary.Published), strconv.Itoa(summary.Failed),
+			summary.Duration, strconv.FormatFloat(summary.Rate, 'f', 1, 64),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	if summary.Failed > 0 {
+		return fmt.Errorf("%d of %d messages failed", summary.Failed, summary.Published+summary.Failed)
+	}
+	return nil
+}
+
+// tailedMessage tail命令输出的一条消息
+type tailedMessage struct {
+	MsgId      string
+	MsgBody    string
+	ReceivedAt time.Time
+}
+
+// messagePrinter 按输出格式逐条输出消息，json为每行一个对象，yaml为多文档
+type messagePrinter struct {
+	w      io.Writer
+	format string
+	mutex  sync.Mutex
+}
+
+func (p *messagePrinter) print(msg tailedMessage) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	switch p.format {
+	case formatJSON:
+		return json.NewEncoder(p.w).Encode(msg)
+	case formatYAML:
+		fmt.Fprintln(p.w, "---")
+		return yaml.NewEncoder(p.w).Encode(map[string]string{
+			"MsgId":      msg.MsgId,
+			"MsgBody":    msg.MsgBody,
+			"ReceivedAt": msg.ReceivedAt.Format(time.RFC3339Nano),
+		})
+	default:
+		_, err := fmt.Fprintf(p.w, "%s  %s  %s\n", msg.ReceivedAt.Format("15:04:05.000"), msg.MsgId, msg.MsgBody)
+		return err
+	}
+}
+
+func runTail(a *app, args []string) error {
+	fs := newFlagSet(a, "tail", "")
+	queueID := fs.String("queue", a.conf.QueueID, "queue ID")
+	consumerID := fs.String("consumer-id", a.conf.ConsumerID, "consumer ID")
+	consumerToken := fs.String("consumer-token", a.conf.ConsumerToken, "consumer token")
+	mode := fs.String("mode", "subscribe", "subscribe (websocket push) or get (HTTP polling)")
+	noAck := fs.Bool("no-ack", false, "peek only: do not ack messages, so they are redelivered later")
+	maxCount := fs.Int("max", 0, "exit after receiving this many messages (0 for no limit)")
+	batch := fs.Int("batch", 10, "messages per GetMsg call in get mode")
+	interval := fs.Duration("interval", time.Second, "polling interval in get mode when the queue is empty")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if *queueID == "" || *consumerID == "" || *consumerToken == "" {
+		fmt.Fprintln(a.stderr, "umqctl tail: -queue, -consumer-id and -consumer-token are required (or QueueID, ConsumerID and ConsumerToken in the configuration)")
+		return errUsage
+	}
+	if *mode != "subscribe" && *mode != "get" {
+		fmt.Fprintf(a.stderr, "umqctl tail: unknown mode %q, expected subscribe or get\n", *mode)
+		return errUsage
+	}
+
+	client, err := a.umqClient()
+	if err != nil {
+		return err
+	}
+	consumer := client.NewConsumer(*consumerID, *consumerToken)
+	printer := &messagePrinter{w: a.stdout, format: a.format}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *mode == "get" {
+		return tailGet(ctx, consumer, printer, *queueID, *batch, *interval, *maxCount, *noAck)
+	}
+	return tailSubscribe(ctx, consumer, printer, *queueID, *maxCount, *noAck)
+}
+
+func tailGet(ctx context.Context, consumer *umq.UmqConsumer, printer *messagePrinter,
+	queueID string, batch int, interval time.Duration, maxCount int, noAck bool) error {
+	received := 0
+	for ctx.Err() == nil {
+		info, err := consumer.GetMsgContext(ctx, queueID, batch)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return err
+		}
+		for _, msg := range info.Msgs {
+			if err := printer.print(tailedMessage{msg.MsgId, msg.MsgBody, time.Now()}); err != nil {
+				return err
+			}
+			if !noAck {
+				if err := consumer.AckMsgContext(ctx, queueID, msg.MsgId); err != nil {
+					return err
+				}
+			}
+			received++
+			if maxCount > 0 && received >= maxCount {
+				return nil
+			}
+		}
+		if len(info.Msgs) == 0 {
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+			}
+		}
+	}
+	return nil
+}
+
+func tailSubscribe(ctx context.Context, consumer *umq.UmqConsumer, printer *messagePrinter,
+	queueID string, maxCount int, noAck bool) error {
+	var (
+		mutex    sync.Mutex
+		received int
+		printErr error
+	)
+	done := make(chan struct{})
+	var doneOnce sync.Once
+	finish := func() { doneOnce.Do(func() { close(done) }) }
+
+	subErr := make(chan error, 1)
+	go func() {
+		subErr <- consumer.SubscribeQueue(queueID, func(c chan string, msg umq.Message) {
+			mutex.Lock()
+			// 达到上限后连接关闭前仍可能收到消息，不再处理也不ack
+			if maxCount > 0 && received >= maxCount || printErr != nil {
+				mutex.Unlock()
+				return
+			}
+			received++
+			last := maxCount > 0 && received >= maxCount
+			err := printer.print(tailedMessage{msg.MsgId, msg.MsgBody, time.Now()})
+			if err != nil {
+				printErr = err
+			}
+			mutex.Unlock()
+
+			if !noAck {
+				c <- msg.MsgId
+			}
+			if last || err != nil {
+				finish()
+			}
+		})
+	}()
+
+	select {
+	case err := <-subErr:
+		return err
+	case <-ctx.Done():
+	case <-done:
+	}
+	consumer.UnSubscribe(queueID)
+	// 退出订阅后正在ack的handler可能无法返回，因此只等待有限的时间
+	select {
+	case err := <-subErr:
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+	case <-time.After(unsubscribeWait):
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	return printErr
+}
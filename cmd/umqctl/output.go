@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 支持的输出格式
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+// result 命令的输出，value用于json/yaml，headers和rows用于表格
+type result struct {
+	value   interface{}
+	headers []string
+	rows    [][]string
+}
+
+func checkFormat(format string) error {
+	switch format {
+	case formatTable, formatJSON, formatYAML:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, expected table, json or yaml", format)
+}
+
+func writeResult(w io.Writer, format string, res result) error {
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res.value)
+	case formatYAML:
+		return writeYAML(w, res.value)
+	default:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(res.headers, "\t"))
+		for _, row := range res.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	}
+}
+
+// writeYAML 先经过JSON转换，使YAML的字段名与JSON输出保持一致
+func writeYAML(w io.Writer, v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(yamlNumbers(generic)); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// yamlNumbers 将json.Number还原为整数或浮点数，避免时间戳等整数以科学计数法输出
+func yamlNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = yamlNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = yamlNumbers(e)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+	}
+	return v
+}
+
+// formatUnix 将API返回的秒级时间戳格式化为本地时间
+func formatUnix(sec int64) string {
+	if sec == 0 {
+		return "-"
+	}
+	return time.Unix(sec, 0).Format("2006-01-02 15:04:05")
+}
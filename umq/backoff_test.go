@@ -0,0 +1,33 @@
+package umq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		policy  RetryPolicy
+		attempt int
+		// 抖动前的等待时间，结果应在[base/2, base]内
+		base time.Duration
+	}{
+		{RetryPolicy{}, 1, DefaultRetryBackoff},
+		{RetryPolicy{}, 2, 2 * DefaultRetryBackoff},
+		{RetryPolicy{}, 100, DefaultRetryMaxBackoff},
+		{RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: time.Second}, 1, 10 * time.Millisecond},
+		{RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: time.Second}, 4, 80 * time.Millisecond},
+		{RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: time.Second}, 8, time.Second},
+		{RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: time.Second}, 1000, time.Second},
+		// Backoff大于MaxBackoff时以MaxBackoff为准
+		{RetryPolicy{Backoff: 5 * time.Second, MaxBackoff: time.Second}, 1, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if d := tt.policy.backoff(tt.attempt); d < tt.base/2 || d > tt.base {
+				t.Errorf("%+v.backoff(%d) = %v, want within [%v, %v]", tt.policy, tt.attempt, d, tt.base/2, tt.base)
+				break
+			}
+		}
+	}
+}
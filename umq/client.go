@@ -1,11 +1,19 @@
 package umq
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/ucloud/umq-sdk-go/umq/websocket"
 )
 
 type httpResult struct {
@@ -53,7 +61,7 @@ func (client *UmqClient) CreateQueue(projectID, couponID, remark, queueName, pus
 		"PublicKey": client.publicKey,
 	}
 
-	res, err := sendAPIHttpRequest(req, client.privateKey, 10)
+	res, err := sendAPIHttpRequest(client.apiClient, client.apiURL, req, client.privateKey, 10)
 	if err != nil {
 		return nil, err
 	}
@@ -83,7 +91,7 @@ func (client *UmqClient) DeleteQueue(queueId string, projectId string) (interfac
 		req["ProjectId"] = projectId
 	}
 
-	res, err := sendAPIHttpRequest(req, client.privateKey, 10)
+	res, err := sendAPIHttpRequest(client.apiClient, client.apiURL, req, client.privateKey, 10)
 	if err != nil {
 		return nil, err
 	}
@@ -113,7 +121,7 @@ func (client *UmqClient) ListQueue(limit int, offset int, projectId string) (int
 		req["ProjectId"] = projectId
 	}
 
-	res, err := sendAPIHttpRequest(req, client.privateKey, 10)
+	res, err := sendAPIHttpRequest(client.apiClient, client.apiURL, req, client.privateKey, 10)
 	if err != nil {
 		return nil, err
 	}
@@ -144,7 +152,7 @@ func (client *UmqClient) ListQueue(limit int, offset int, projectId string) (int
 				"Offset":    "0",
 				"PublicKey": client.publicKey,
 			}
-			resPublisher, err := sendAPIHttpRequest(reqPublisher, client.privateKey, 10)
+			resPublisher, err := sendAPIHttpRequest(client.apiClient, client.apiURL, reqPublisher, client.privateKey, 10)
 			if err != nil {
 				return nil, err
 			}
@@ -177,7 +185,7 @@ func (client *UmqClient) ListQueue(limit int, offset int, projectId string) (int
 				"Offset":    "0",
 				"PublicKey": client.publicKey,
 			}
-			resConsumer, err := sendAPIHttpRequest(reqConsumer, client.privateKey, 10)
+			resConsumer, err := sendAPIHttpRequest(client.apiClient, client.apiURL, reqConsumer, client.privateKey, 10)
 			if err != nil {
 				return nil, err
 			}
@@ -228,7 +236,7 @@ func (client *UmqClient) CreateRole(queueId string, num int, role string, projec
 		req["ProjectId"] = projectId
 	}
 
-	res, err := sendAPIHttpRequest(req, client.privateKey, 10)
+	res, err := sendAPIHttpRequest(client.apiClient, client.apiURL, req, client.privateKey, 10)
 	if err != nil {
 		return nil, err
 	}
@@ -271,7 +279,7 @@ func (client *UmqClient) DeleteRole(queueId string, roleId string, role string)
 		"PublicKey": client.publicKey,
 	}
 
-	res, err := sendAPIHttpRequest(req, client.privateKey, 10)
+	res, err := sendAPIHttpRequest(client.apiClient, client.apiURL, req, client.privateKey, 10)
 	if err != nil {
 		return nil, err
 	}
@@ -304,24 +312,79 @@ func (client *UmqClient) NewConsumer(consumerID, consumerToken string) *UmqConsu
 
 // CreateClient 创建client
 func CreateClient(config UmqConfig) (*UmqClient, error) {
-	var httpAddr, wsAddr, wsURL string
-	if len(strings.Split(config.Host, ".")) > 4 {
-		httpAddr = fmt.Sprintf("http://%s:6318/", config.Host)
-		wsAddr = fmt.Sprintf("http://%s:6318/", config.Host)
-		wsURL = fmt.Sprintf("ws://%s:6318/ws", config.Host)
-	} else {
-		httpAddr = fmt.Sprintf("http://%s:6328/", config.Host)
-		wsAddr = fmt.Sprintf("http://%s:6328/", config.Host)
-		wsURL = fmt.Sprintf("ws://%s:6328/ws", config.Host)
+	httpAddr, wsURL, err := resolveEndpoints(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Compression.validate(); err != nil {
+		return nil, err
+	}
+	if err := validHTTPMethod(config.HTTPMethod); err != nil {
+		return nil, err
+	}
+	if err := config.RejectPolicy.validate(); err != nil {
+		return nil, err
+	}
+	wsAddr := httpAddr
+
+	tlsConfig := config.TLSConfig
+	if tlsConfig != nil {
+		tlsConfig = tlsConfig.Clone()
+	}
+	httpClient, apiClient := client, client
+	if config.HTTPTransport != nil {
+		httpClient = &http.Client{Transport: config.HTTPTransport}
+		apiClient = httpClient
+	} else if tlsConfig != nil {
+		httpClient = newTimeoutHTTPClient(time.Duration(10)*time.Second, tlsConfig)
+	}
+
+	dialWebsocket := config.WebsocketDialer
+	if dialWebsocket == nil {
+		dialWebsocket = func(ctx context.Context, config *websocket.Config) (*websocket.Conn, error) {
+			return config.DialContext(ctx)
+		}
+	}
+
+	logger := slog.New(discardHandler{})
+	if config.Logger != nil {
+		logger = slog.New(newRedactHandler(config.Logger.Handler()))
 	}
 
-	orgId, err := getOrganizationId(httpAddr, config.Account, config.ProjectID,
+	orgId, err := getOrganizationId(context.Background(), httpClient, httpAddr, config.Account, config.ProjectID,
 		config.PublicKey, config.PrivateKey)
 
 	if err != nil {
+		logger.Error("umq get organization id failed", "http", httpAddr, "error", err)
 		return nil, err
 	}
 
+	apiURL := config.APIURL
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+
+	handshakeTimeout := config.HandshakeTimeout
+	if handshakeTimeout <= 0 {
+		handshakeTimeout = DefaultHandshakeTimeout
+	}
+
+	metrics := config.Metrics
+	if metrics == nil {
+		metrics = nopMetrics{}
+	}
+
+	tracer := config.Tracer
+	if tracer == nil {
+		tracer = nopTracer{}
+	}
+
+	maxURLLength := config.MaxURLLength
+	if maxURLLength <= 0 {
+		maxURLLength = DefaultMaxURLLength
+	}
+
+	logger.Info("umq client created", "region", config.Region, "http", httpAddr, "websocket", wsURL)
 	return &UmqClient{
 		email:          config.Account,
 		region:         config.Region,
@@ -332,5 +395,81 @@ func CreateClient(config UmqConfig) (*UmqClient, error) {
 		privateKey:     config.PrivateKey,
 		organizationID: orgId,
 		projectID:      config.ProjectID,
+
+		apiURL:           apiURL,
+		apiClient:        apiClient,
+		httpClient:       httpClient,
+		tlsConfig:        tlsConfig,
+		handshakeTimeout: handshakeTimeout,
+		dialer:           config.Dialer,
+		dialWebsocket:    dialWebsocket,
+		metrics:          metrics,
+		tracer:           tracer,
+		logger:           logger,
+		compression:      config.Compression,
+		keys:             config.KeyProvider,
+		signer:           config.Signer,
+		verifier:         config.Verifier,
+		rejectPolicy:     config.RejectPolicy,
+		publishRetry:     config.PublishRetry,
+		request: dataRequest{
+			method:       config.HTTPMethod,
+			maxURLLength: maxURLLength,
+			maxBodySize:  config.MaxBodySize,
+		},
 	}, nil
 }
+
+// resolveEndpoints 根据配置计算HTTP及websocket的接入地址
+func resolveEndpoints(config UmqConfig) (httpAddr, wsURL string, err error) {
+	if config.HTTPURL != "" {
+		u, err := url.Parse(config.HTTPURL)
+		if err != nil {
+			return "", "", err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return "", "", fmt.Errorf("Invalid HTTPURL scheme: %s", u.Scheme)
+		}
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		httpAddr = u.String()
+	} else {
+		if config.Host == "" {
+			return "", "", errors.New("Host or HTTPURL must be provided.")
+		}
+		port := config.Port
+		if port == 0 {
+			if len(strings.Split(config.Host, ".")) > 4 {
+				port = 6318
+			} else {
+				port = 6328
+			}
+		}
+		scheme := "http"
+		if config.UseTLS || config.TLSConfig != nil {
+			scheme = "https"
+		}
+		httpAddr = fmt.Sprintf("%s://%s/", scheme, net.JoinHostPort(config.Host, strconv.Itoa(port)))
+	}
+
+	if config.WebsocketURL != "" {
+		u, err := url.Parse(config.WebsocketURL)
+		if err != nil {
+			return "", "", err
+		}
+		if u.Scheme != "ws" && u.Scheme != "wss" {
+			return "", "", fmt.Errorf("Invalid WebsocketURL scheme: %s", u.Scheme)
+		}
+		return httpAddr, u.String(), nil
+	}
+
+	u, _ := url.Parse(httpAddr)
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/ws"
+	return httpAddr, u.String(), nil
+}
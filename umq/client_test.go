@@ -0,0 +1,114 @@
+package umq
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestResolveEndpoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   UmqConfig
+		httpAddr string
+		wsURL    string
+		wantErr  bool
+	}{
+		{
+			name:     "public host",
+			config:   UmqConfig{Host: "air.bj2.umq.service.ucloud.cn"},
+			httpAddr: "http://air.bj2.umq.service.ucloud.cn:6318/",
+			wsURL:    "ws://air.bj2.umq.service.ucloud.cn:6318/ws",
+		},
+		{
+			name:     "intranet address",
+			config:   UmqConfig{Host: "10.0.0.1"},
+			httpAddr: "http://10.0.0.1:6328/",
+			wsURL:    "ws://10.0.0.1:6328/ws",
+		},
+		{
+			name:     "explicit port",
+			config:   UmqConfig{Host: "10.0.0.1", Port: 8080},
+			httpAddr: "http://10.0.0.1:8080/",
+			wsURL:    "ws://10.0.0.1:8080/ws",
+		},
+		{
+			name:     "ipv6 host",
+			config:   UmqConfig{Host: "::1", Port: 8080},
+			httpAddr: "http://[::1]:8080/",
+			wsURL:    "ws://[::1]:8080/ws",
+		},
+		{
+			name:     "UseTLS",
+			config:   UmqConfig{Host: "10.0.0.1", UseTLS: true},
+			httpAddr: "https://10.0.0.1:6328/",
+			wsURL:    "wss://10.0.0.1:6328/ws",
+		},
+		{
+			name:     "TLSConfig implies TLS",
+			config:   UmqConfig{Host: "10.0.0.1", TLSConfig: &tls.Config{}},
+			httpAddr: "https://10.0.0.1:6328/",
+			wsURL:    "wss://10.0.0.1:6328/ws",
+		},
+		{
+			name:     "HTTPURL without path",
+			config:   UmqConfig{HTTPURL: "https://umq.example.com", Host: "ignored"},
+			httpAddr: "https://umq.example.com/",
+			wsURL:    "wss://umq.example.com/ws",
+		},
+		{
+			name:     "HTTPURL with path",
+			config:   UmqConfig{HTTPURL: "http://proxy.example.com:8080/umq/"},
+			httpAddr: "http://proxy.example.com:8080/umq/",
+			wsURL:    "ws://proxy.example.com:8080/umq/ws",
+		},
+		{
+			name:     "HTTPURL with path without trailing slash",
+			config:   UmqConfig{HTTPURL: "http://proxy.example.com/umq"},
+			httpAddr: "http://proxy.example.com/umq",
+			wsURL:    "ws://proxy.example.com/umq/ws",
+		},
+		{
+			name:     "explicit WebsocketURL",
+			config:   UmqConfig{Host: "10.0.0.1", WebsocketURL: "wss://ws.example.com/sub"},
+			httpAddr: "http://10.0.0.1:6328/",
+			wsURL:    "wss://ws.example.com/sub",
+		},
+		{
+			name:    "no host",
+			config:  UmqConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "bad HTTPURL scheme",
+			config:  UmqConfig{HTTPURL: "ws://umq.example.com/"},
+			wantErr: true,
+		},
+		{
+			name:    "bad WebsocketURL scheme",
+			config:  UmqConfig{Host: "10.0.0.1", WebsocketURL: "https://ws.example.com/"},
+			wantErr: true,
+		},
+		{
+			name:    "unparsable HTTPURL",
+			config:  UmqConfig{HTTPURL: "http://%zz"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpAddr, wsURL, err := resolveEndpoints(tt.config)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %q, %q, want error", httpAddr, wsURL)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if httpAddr != tt.httpAddr || wsURL != tt.wsURL {
+				t.Errorf("got %q, %q, want %q, %q", httpAddr, wsURL, tt.httpAddr, tt.wsURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package umq
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// CompressionGzip 内置的gzip压缩，zstd及snappy由umqcompress包注册
+const CompressionGzip = "gzip"
+
+// DefaultCompressionThreshold 默认只压缩不小于该字节数的消息体
+const DefaultCompressionThreshold = 1024
+
+// MaxDecompressedSize 解压后消息体的最大字节数，超过时消息不交给handler，按RejectPolicy处理
+const MaxDecompressedSize = 64 << 20
+
+var (
+	// ErrDecompressedTooLarge 解压后的数据超过MaxDecompressedSize
+	ErrDecompressedTooLarge = errors.New("umq: decompressed message exceeds MaxDecompressedSize")
+	// ErrUnknownCompression 消息使用的压缩算法未在消费者注册
+	ErrUnknownCompression = errors.New("umq: unknown compression algorithm")
+)
+
+// EnvelopeError 封装格式的消息体无法还原：不是合法的base64、压缩算法未注册或解压失败
+// 这类消息不会交给handler，按RejectPolicy处理
+type EnvelopeError struct {
+	// 消息使用的压缩算法，未压缩时为空
+	Compression string
+	Err         error
+}
+
+func (e *EnvelopeError) Error() string {
+	if e.Compression == "" {
+		return fmt.Sprintf("umq: decode message body: %v", e.Err)
+	}
+	return fmt.Sprintf("umq: decode message body compressed with %q: %v", e.Compression, e.Err)
+}
+
+func (e *EnvelopeError) Unwrap() error {
+	return e.Err
+}
+
+// Compression 消息体的压缩配置，通过UmqConfig.Compression设置
+// 压缩后的消息以SDK封装格式发送，消费者需使用本SDK并注册了对应的算法才能自动解压
+type Compression struct {
+	// 压缩算法，例如CompressionGzip，为空时不压缩
+	Algorithm string
+	// 压缩级别，含义由算法决定，0表示算法的默认级别
+	Level int
+	// 消息体不小于Threshold字节时才压缩，0表示DefaultCompressionThreshold
+	Threshold int
+}
+
+// Compressor 压缩算法的实现
+type Compressor interface {
+	// Compress 以level压缩src，level为0时使用默认级别
+	Compress(src []byte, level int) ([]byte, error)
+	// Decompress 解压src，结果超过maxSize字节时返回ErrDecompressedTooLarge
+	Decompress(src []byte, maxSize int) ([]byte, error)
+}
+
+var (
+	compressorsMutex sync.RWMutex
+	compressors      = map[string]Compressor{
+		CompressionGzip: gzipCompressor{},
+	}
+)
+
+// RegisterCompressor 注册压缩算法，name写入消息封装，生产者和消费者须使用相同的名称
+func RegisterCompressor(name string, c Compressor) {
+	compressorsMutex.Lock()
+	defer compressorsMutex.Unlock()
+	compressors[name] = c
+}
+
+func lookupCompressor(name string) (Compressor, bool) {
+	compressorsMutex.RLock()
+	defer compressorsMutex.RUnlock()
+	c, ok := compressors[name]
+	return c, ok
+}
+
+// validate 检查配置的算法是否已注册
+func (c Compression) validate() error {
+	if c.Algorithm == "" {
+		return nil
+	}
+	if _, ok := lookupCompressor(c.Algorithm); !ok {
+		return fmt.Errorf("%w %q", ErrUnknownCompression, c.Algorithm)
+	}
+	return nil
+}
+
+// shouldCompress 判断size字节的消息体是否需要压缩
+func (c Compression) shouldCompress(size int) bool {
+	if c.Algorithm == "" {
+		return false
+	}
+	threshold := c.Threshold
+	if threshold <= 0 {
+		threshold = DefaultCompressionThreshold
+	}
+	return size >= threshold
+}
+
+// ReadLimited 读取r的全部内容，超过maxSize字节时返回ErrDecompressedTooLarge，供Compressor实现使用
+func ReadLimited(r io.Reader, maxSize int) ([]byte, error) {
+	buf, err := io.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) > maxSize {
+		return nil, ErrDecompressedTooLarge
+	}
+	return buf, nil
+}
+
+type gzipCompressor struct{}
+
+// gzipWriters 按压缩级别复用gzip.Writer，创建Writer的开销远大于压缩小消息本身
+var gzipWriters sync.Map // level -> *sync.Pool
+
+func (gzipCompressor) Compress(src []byte, level int) ([]byte, error) {
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	pool, _ := gzipWriters.LoadOrStore(level, &sync.Pool{})
+	w, _ := pool.(*sync.Pool).Get().(*gzip.Writer)
+	if w == nil {
+		var err error
+		if w, err = gzip.NewWriterLevel(&buf, level); err != nil {
+			return nil, err
+		}
+	} else {
+		w.Reset(&buf)
+	}
+	defer pool.(*sync.Pool).Put(w)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(src []byte, maxSize int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ReadLimited(r, maxSize)
+}
@@ -0,0 +1,116 @@
+package umq
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// sampleJSON 返回约size字节的JSON事件流，字段名重复而取值随机，接近实际业务消息
+func sampleJSON(size int) string {
+	r := rand.New(rand.NewSource(1))
+	var b strings.Builder
+	b.WriteByte('[')
+	for i := 0; b.Len() < size; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `{"id":%d,"user":"user-%05d","event":"%s","amount":%d.%02d,"ts":%d}`,
+			i, r.Intn(100000), []string{"created", "paid", "shipped", "refunded"}[r.Intn(4)],
+			r.Intn(10000), r.Intn(100), 1700000000000+r.Int63n(1e9))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	body := sampleJSON(4096)
+	for _, level := range []int{0, gzip.BestSpeed, gzip.BestCompression} {
+		client := &UmqClient{compression: Compression{Algorithm: CompressionGzip, Level: level}}
+		content, err := client.encodeEnvelope(context.Background(), "q", Envelope{Body: body})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(content) >= len(body) {
+			t.Errorf("level %d: content is %d bytes, body %d", level, len(content), len(body))
+		}
+		env, _, err := client.decodeEnvelope(context.Background(), "q", content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if env.Body != body {
+			t.Fatalf("level %d: body changed", level)
+		}
+	}
+}
+
+func TestDecodeEnvelopeErrors(t *testing.T) {
+	var bomb bytes.Buffer
+	w := gzip.NewWriter(&bomb)
+	w.Write(make([]byte, MaxDecompressedSize+1))
+	w.Close()
+	tests := []struct {
+		name    string
+		content string
+		want    error
+	}{
+		{"bad base64", `{"umq":1,"enc":"base64url","b":"!!!"}`, nil},
+		{"bad base64 compressed", `{"umq":1,"z":"gzip","b":"not base64"}`, nil},
+		{"unknown algorithm", `{"umq":1,"z":"lz4","b":"AAAA"}`, ErrUnknownCompression},
+		{"corrupt gzip", `{"umq":1,"z":"gzip","b":"AAAAAAAA"}`, nil},
+		{"too large", `{"umq":1,"z":"gzip","b":"` + base64Encoding.EncodeToString(bomb.Bytes()) + `"}`, ErrDecompressedTooLarge},
+	}
+	client := &UmqClient{}
+	for _, tt := range tests {
+		env, _, err := client.decodeEnvelope(context.Background(), "q", tt.content)
+		var envErr *EnvelopeError
+		if env != nil || !errors.As(err, &envErr) {
+			t.Errorf("%s: env = %v, err = %v, want *EnvelopeError", tt.name, env, err)
+			continue
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// BenchmarkCompression 报告各级别gzip压缩后Content占原始消息体的百分比（wire%）及编码速度，
+// zstd及snappy的结果见umqcompress包的同名benchmark
+func BenchmarkCompression(b *testing.B) {
+	levels := []struct {
+		name  string
+		level int
+	}{
+		{"none", 0},
+		{"gzip-1", gzip.BestSpeed},
+		{"gzip-default", 0},
+		{"gzip-9", gzip.BestCompression},
+	}
+	for _, size := range []int{1536, 16 << 10} {
+		body := sampleJSON(size)
+		for _, l := range levels {
+			b.Run(fmt.Sprintf("%s/%d", l.name, size), func(b *testing.B) {
+				client := &UmqClient{}
+				if l.name != "none" {
+					client.compression = Compression{Algorithm: CompressionGzip, Level: l.level, Threshold: 1}
+				}
+				env := Envelope{Body: body, IdempotencyKey: newIdempotencyKey()}
+				var content string
+				b.SetBytes(int64(len(body)))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					var err error
+					if content, err = client.encodeEnvelope(context.Background(), "q", env); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(100*float64(len(content))/float64(len(body)), "wire%")
+			})
+		}
+	}
+}
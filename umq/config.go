@@ -1,5 +1,16 @@
 package umq
 
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ucloud/umq-sdk-go/umq/websocket"
+)
+
 const (
 	// RegionCnBj2 地域: 北京2
 	RegionCnBj2 = "cn-bj2"
@@ -11,6 +22,20 @@ const (
 type UmqConfig struct {
 	// 主机地址 例如 air.bj2.umq.service.ucloud.cn
 	Host string
+	// 端口，为0时根据Host自动选择6318或6328
+	Port int
+	// 是否使用TLS (https:// 及 wss://)，设置了TLSConfig时同样启用
+	UseTLS bool
+	// HTTP接入点的完整URL，例如 https://air.bj2.umq.service.ucloud.cn:6318/
+	// 设置后忽略Host、Port及UseTLS
+	HTTPURL string
+	// websocket接入点的完整URL，例如 wss://air.bj2.umq.service.ucloud.cn:6318/ws
+	// 为空时由HTTP接入点推导
+	WebsocketURL string
+	// 管理API (UmqCreateQueue等) 的地址，默认为 DefaultAPIURL
+	APIURL string
+	// TLS配置，可指定自定义CA、客户端证书及ServerName，HTTP及websocket连接均使用该配置
+	TLSConfig *tls.Config
 	// 地域, 例如 RegionCnBj2
 	Region string
 	// 账户信息
@@ -21,4 +46,48 @@ type UmqConfig struct {
 	PublicKey string
 	// 账户的私钥
 	PrivateKey string
+	// websocket握手超时时间，包括TCP连接、TLS握手、HTTP升级及订阅回包，默认为10秒
+	HandshakeTimeout time.Duration
+	// 建立websocket连接时使用的net.Dialer，可用于指定本地地址、keepalive等，为空时使用默认值
+	Dialer *net.Dialer
+	// 所有HTTP请求（包括管理API）使用的Transport，为空时使用SDK默认的Transport
+	// 设置后TLSConfig不再作用于HTTP请求，需由该Transport自行配置
+	HTTPTransport http.RoundTripper
+	// 建立websocket连接的函数，为空时使用websocket.Config.DialContext
+	WebsocketDialer WebsocketDialFunc
+	// 指标回调，为空时不采集指标
+	Metrics Metrics
+	// 链路追踪回调，为空时不追踪
+	// 设置后发布的消息会封装trace上下文，消费者需使用支持该格式的SDK版本
+	Tracer Tracer
+	// 结构化日志，为空时不输出日志
+	// PrivateKey、各类Token及Signature会在写入前自动脱敏
+	Logger *slog.Logger
+	// 消息体压缩，Algorithm为空时不压缩
+	Compression Compression
+	// 消息体加密使用的密钥，设置后发布的消息以AES-GCM加密，消费者须配置包含对应密钥的KeyProvider
+	KeyProvider KeyProvider
+	// 消息签名，设置后发布的每条消息都以SDK封装格式发送并附带签名
+	Signer Signer
+	// 签名验证，设置后消费者拒绝没有签名或签名无效的消息，包括普通字符串消息
+	Verifier Verifier
+	// 消费者拒绝消息（签名无效、无法解密）时的处理方式，默认为RejectNack
+	RejectPolicy RejectPolicy
+	// 发布失败时的重试策略，默认不重试
+	PublishRetry RetryPolicy
+	// PublishMsg、GetMsg及AckMsg使用的HTTP方法，默认为HTTPMethodAuto
+	HTTPMethod string
+	// GET请求URL的最大长度，超过时改用POST或返回ErrMessageTooLarge，0表示DefaultMaxURLLength
+	MaxURLLength int
+	// POST请求体的最大长度，超过时返回ErrMessageTooLarge，0表示不在本地检查
+	MaxBodySize int
 }
+
+// WebsocketDialFunc 根据config建立websocket连接，ctx的超时为握手超时
+type WebsocketDialFunc func(ctx context.Context, config *websocket.Config) (*websocket.Conn, error)
+
+// DefaultAPIURL 默认的管理API地址
+const DefaultAPIURL = "https://api.ucloud.cn"
+
+// DefaultHandshakeTimeout 默认的websocket握手超时时间
+const DefaultHandshakeTimeout = 10 * time.Second
@@ -1,6 +1,8 @@
 package umq
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"math/rand"
@@ -25,6 +27,15 @@ type subscribeInfo struct {
 	conn           *websocket.Conn
 	retryConnTimes uint8
 	mutex          *sync.Mutex
+
+	connected   bool
+	lastMsgTime time.Time
+	lastErr     error
+	reconnects  int
+
+	// 订阅的生命周期，UnSubscribe时取消，是投递给MsgHandler的消息Context的父context
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // UmqConsumer consumer的实例
@@ -48,6 +59,18 @@ func newConsumer(client *UmqClient, consumerID, consumerToken string) *UmqConsum
 
 // GetMsg 获取queueId对应的topic的num条消息
 func (consumer *UmqConsumer) GetMsg(queueId string, num int) (*MessageInfo, error) {
+	return consumer.GetMsgContext(context.Background(), queueId, num)
+}
+
+// GetMsgContext 同GetMsg，ctx作为Tracer的父span
+func (consumer *UmqConsumer) GetMsgContext(ctx context.Context, queueId string, num int) (*MessageInfo, error) {
+	_, end := consumer.client.tracer.StartGetMsg(ctx, queueId, num)
+	info, err := consumer.getMsg(ctx, queueId, num)
+	end(err)
+	return info, err
+}
+
+func (consumer *UmqConsumer) getMsg(ctx context.Context, queueId string, num int) (*MessageInfo, error) {
 	req := map[string]string{
 		"Action":         "GetMsg",
 		"QueueId":        queueId,
@@ -58,7 +81,7 @@ func (consumer *UmqConsumer) GetMsg(queueId string, num int) (*MessageInfo, erro
 		"Num":            strconv.Itoa(num),
 	}
 
-	res, err := sendHTTPRequest(consumer.client.httpAddr, req, 10)
+	res, err := consumer.client.sendDataRequest(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -71,11 +94,39 @@ func (consumer *UmqConsumer) GetMsg(queueId string, num int) (*MessageInfo, erro
 	if resBody.RetCode != 0 {
 		return nil, fmt.Errorf("Fail to get message: %s", resBody.Message)
 	}
+	// 被拒绝的消息不返回给调用方，按RejectPolicy处理
+	msgs := resBody.Data.Msgs[:0]
+	for _, msg := range resBody.Data.Msgs {
+		if err := consumer.client.unwrap(ctx, queueId, &msg); err != nil {
+			if consumer.client.reject(ctx, queueId, msg, err) {
+				if err := consumer.AckMsgContext(ctx, queueId, msg.MsgId); err != nil {
+					consumer.client.logger.Error("umq ack failed", "queue", queueId, "msg_id", msg.MsgId, "error", err)
+				}
+			}
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	resBody.Data.Msgs = msgs
 	return &resBody.Data, nil
 }
 
 // AckMsg ack queueid对应topic的一条消息，msgId为该消息的message id
 func (consumer *UmqConsumer) AckMsg(queueId, msgId string) error {
+	return consumer.AckMsgContext(context.Background(), queueId, msgId)
+}
+
+// AckMsgContext 同AckMsg，ctx作为Tracer的父span
+func (consumer *UmqConsumer) AckMsgContext(ctx context.Context, queueId, msgId string) error {
+	start := time.Now()
+	_, end := consumer.client.tracer.StartAck(ctx, queueId, msgId)
+	err := consumer.ackMsg(ctx, queueId, msgId)
+	end(err)
+	consumer.client.metrics.AckDone(queueId, time.Since(start), err)
+	return err
+}
+
+func (consumer *UmqConsumer) ackMsg(ctx context.Context, queueId, msgId string) error {
 	req := map[string]string{
 		"Action":        "AckMsg",
 		"Region":        consumer.client.region,
@@ -85,7 +136,7 @@ func (consumer *UmqConsumer) AckMsg(queueId, msgId string) error {
 		"MsgId":         msgId,
 	}
 
-	resp, err := sendHTTPRequest(consumer.client.httpAddr, req, 10)
+	resp, err := consumer.client.sendDataRequest(ctx, req)
 	if err != nil {
 		return err
 	}
@@ -118,14 +169,19 @@ func (consumer *UmqConsumer) UnSubscribe(queueId string) error {
 		return nil
 	}
 	delete(consumer.subInfo, queueId)
-	info.subscribe = false
 	consumer.mutex.Unlock()
+	info.mutex.Lock()
+	info.subscribe = false
+	info.mutex.Unlock()
 	info.stop <- info
+	consumer.client.logger.Info("umq unsubscribed", "queue", queueId)
 	return nil
 }
 
 // SubscribeQueue 订阅queueId指向的topic
 // 成功订阅之后，消息会通过msgHandler回调
+// 连接断开时会自动重连；若服务端以CloseStatusPolicyViolation关闭连接（例如鉴权被撤销），
+// 则停止订阅并返回对应的*websocket.CloseError
 func (consumer *UmqConsumer) SubscribeQueue(queueId string, msgHandler MsgHandler) error {
 	consumer.mutex.Lock()
 	if _, ok := consumer.subInfo[queueId]; ok {
@@ -134,17 +190,23 @@ func (consumer *UmqConsumer) SubscribeQueue(queueId string, msgHandler MsgHandle
 	}
 	consumer.mutex.Unlock()
 
+	logger := consumer.client.logger.With("queue", queueId)
 	conn, err := consumer.handshake(queueId)
 	if err != nil {
+		logger.Warn("umq subscribe failed", "error", err)
 		return err
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 	subInfo := &subscribeInfo{
+		ctx:            ctx,
+		cancel:         cancel,
 		subscribe:      true,
 		lastConnTime:   time.Now(),
 		stop:           make(chan *subscribeInfo),
 		conn:           conn,
 		retryConnTimes: 0,
 		mutex:          &sync.Mutex{},
+		connected:      true,
 	}
 	ackMsg := make(chan string)
 
@@ -152,15 +214,18 @@ func (consumer *UmqConsumer) SubscribeQueue(queueId string, msgHandler MsgHandle
 		for {
 			select {
 			case MsgId := <-ackMsg:
+				consumer.client.metrics.InFlight(queueId, -1)
 				if MsgId == "" {
-				} else {
-					consumer.AckMsg(queueId, MsgId)
+				} else if err := consumer.AckMsg(queueId, MsgId); err != nil {
+					// ack失败的消息会在超时后被服务端重新投递
+					logger.Error("umq ack failed", "msg_id", MsgId, "error", err)
 				}
 			case info := <-subInfo.stop:
 				info.mutex.Lock()
 				info.subscribe = false
 				info.conn.Close()
 				info.mutex.Unlock()
+				info.cancel()
 				return
 			}
 		}
@@ -170,8 +235,23 @@ func (consumer *UmqConsumer) SubscribeQueue(queueId string, msgHandler MsgHandle
 	consumer.subInfo[queueId] = subInfo
 	consumer.mutex.Unlock()
 
+	metrics := consumer.client.metrics
+	metrics.ConnectionState(queueId, true)
+	logger.Info("umq subscribed")
 	for {
-		err = consumer.loopReceive(subInfo.conn, ackMsg, msgHandler)
+		err = consumer.loopReceive(queueId, subInfo, ackMsg, msgHandler)
+		subInfo.mutex.Lock()
+		subInfo.connected = false
+		subInfo.lastErr = err
+		subInfo.mutex.Unlock()
+		metrics.ConnectionState(queueId, false)
+		if closeErr, ok := err.(*websocket.CloseError); ok && isFatalClose(closeErr) {
+			// 服务端主动关闭且不应重连，例如鉴权被撤销
+			logger.Error("umq subscription closed by server", "code", closeErr.Code, "reason", closeErr.Text)
+			consumer.UnSubscribe(queueId)
+			return closeErr
+		}
+		logger.Warn("umq connection lost", "error", err)
 		connected, err := consumer.reconnect(queueId)
 		if err != nil {
 			return err
@@ -179,26 +259,65 @@ func (consumer *UmqConsumer) SubscribeQueue(queueId string, msgHandler MsgHandle
 		if !connected {
 			return nil
 		}
+		logger.Info("umq reconnected")
+		metrics.Reconnected(queueId)
+		metrics.ConnectionState(queueId, true)
 	}
 }
 
-func (consumer *UmqConsumer) loopReceive(conn *websocket.Conn, ackMsg chan string, msgHandler MsgHandler) error {
+func (consumer *UmqConsumer) loopReceive(queueId string, info *subscribeInfo, ackMsg chan string, msgHandler MsgHandler) error {
+	info.mutex.Lock()
+	conn := info.conn
+	info.mutex.Unlock()
+	metrics := consumer.client.metrics
+	tracer := consumer.client.tracer
+	// msgBuf在多次接收之间复用，解码后的消息不引用它
+	var msgBuf bytes.Buffer
 	for {
-		var msgBuf []byte
-		err := websocket.Message.Receive(conn, &msgBuf)
+		_, r, err := conn.NextReader()
 		if err != nil {
 			return err
 		}
+		msgBuf.Reset()
+		if _, err = msgBuf.ReadFrom(r); err != nil {
+			return err
+		}
 
 		var data wsMessagePack
-		err = json.Unmarshal(msgBuf, &data)
+		err = json.Unmarshal(msgBuf.Bytes(), &data)
 		if err != nil {
+			consumer.client.logger.Warn("umq decode message failed", "queue", queueId, "size", msgBuf.Len(), "error", err)
 			return err
 		}
-		msgHandler(ackMsg, data.Data)
+		info.mutex.Lock()
+		info.lastMsgTime = time.Now()
+		info.mutex.Unlock()
+		metrics.MessageReceived(queueId)
+		metrics.InFlight(queueId, 1)
+		msg := data.Data
+		if err := consumer.client.unwrap(context.Background(), queueId, &msg); err != nil {
+			// 不交给handler，按RejectPolicy决定是否ack
+			if consumer.client.reject(context.Background(), queueId, msg, err) {
+				ackMsg <- msg.MsgId
+			} else {
+				metrics.InFlight(queueId, -1)
+			}
+			continue
+		}
+		var end SpanEnd
+		msg.ctx, end = tracer.StartHandler(info.ctx, queueId, msg, msg.headers())
+		start := time.Now()
+		msgHandler(ackMsg, msg)
+		metrics.HandlerDone(queueId, time.Since(start))
+		end(nil)
 	}
 }
 
+// isFatalClose 判断服务端的关闭帧是否表示不应再重连
+func isFatalClose(err *websocket.CloseError) bool {
+	return err.Code == websocket.CloseStatusPolicyViolation
+}
+
 func (consumer *UmqConsumer) reconnect(queueId string) (connected bool, err error) {
 	var (
 		target *subscribeInfo
@@ -223,32 +342,52 @@ func (consumer *UmqConsumer) reconnect(queueId string) (connected bool, err erro
 		}
 		conn, err = consumer.handshake(queueId)
 		if err != nil {
+			target.mutex.Lock()
 			target.retryConnTimes++
-			sleepTime := 1000 * int(target.retryConnTimes)
+			target.lastErr = err
+			attempts := target.retryConnTimes
+			target.mutex.Unlock()
+			sleepTime := 1000 * int(attempts)
 			if sleepTime > 10000 {
 				// maximum period is 10 seconds
 				sleepTime = 10000
 			}
 			sleepTime += rand.Intn(1000)
+			consumer.client.logger.Warn("umq reconnect failed", "queue", queueId,
+				"attempt", attempts, "backoff", time.Duration(sleepTime)*time.Millisecond, "error", err)
 			time.Sleep(time.Duration(sleepTime) * time.Millisecond)
 			continue
 		}
-		target.lastConnTime = time.Now()
-		target.retryConnTimes = 0
 		break
 	}
 	target.mutex.Lock()
 	target.conn = conn
+	target.lastConnTime = time.Now()
+	target.retryConnTimes = 0
+	target.reconnects++
+	target.connected = true
 	target.mutex.Unlock()
 	connected = true
 	return
 }
 
 func (consumer *UmqConsumer) handshake(queueId string) (*websocket.Conn, error) {
-	wsConn, err := websocket.Dial(consumer.client.wsUrl, "", consumer.client.wsAddr)
+	config, err := websocket.NewConfig(consumer.client.wsUrl, consumer.client.wsAddr)
+	if err != nil {
+		return nil, err
+	}
+	config.Dialer = consumer.client.dialer
+	config.TlsConfig = consumer.client.tlsConfig
+
+	ctx, cancel := context.WithTimeout(context.Background(), consumer.client.handshakeTimeout)
+	defer cancel()
+	wsConn, err := consumer.client.dialWebsocket(ctx, config)
 	if err != nil {
 		return nil, err
 	}
+	// 订阅请求及回包同样受握手超时限制，完成后清除deadline
+	deadline, _ := ctx.Deadline()
+	wsConn.SetDeadline(deadline)
 	orgId, _ := strconv.ParseUint(consumer.client.organizationID, 10, 64)
 	wsData := startConsumeReq{
 		OrganizationId: orgId,
@@ -281,5 +420,6 @@ func (consumer *UmqConsumer) handshake(queueId string) (*websocket.Conn, error)
 		wsConn.Close()
 		return nil, err
 	}
+	wsConn.SetDeadline(time.Time{})
 	return wsConn, nil
 }
@@ -0,0 +1,111 @@
+package umq_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+	"github.com/ucloud/umq-sdk-go/umq/websocket"
+)
+
+func TestSubscribeHandshakeTimeout(t *testing.T) {
+	// 接受TCP连接但从不响应websocket升级
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	_, _, consumer, queueID := newTestClient(t, func(c *umq.UmqConfig) {
+		c.WebsocketURL = "ws://" + ln.Addr().String() + "/ws"
+		c.HandshakeTimeout = 100 * time.Millisecond
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- consumer.SubscribeQueue(queueID, func(c chan string, msg umq.Message) { c <- msg.MsgId })
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("subscribe succeeded against a server that never upgrades")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SubscribeQueue did not honour HandshakeTimeout")
+	}
+}
+
+// waitFor 轮询直到cond成立，超时时测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubscribeCloseCodes(t *testing.T) {
+	srv, producer, consumer, queueID := newTestClient(t, nil)
+	received := make(chan string, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- consumer.SubscribeQueue(queueID, func(c chan string, msg umq.Message) {
+			received <- msg.MsgBody
+			c <- msg.MsgId
+		})
+	}()
+	connected := func() bool {
+		status, ok := consumer.Status(queueID)
+		return ok && status.Connected
+	}
+	waitFor(t, "subscription", connected)
+
+	// 其他关闭码重连
+	srv.CloseConsumers(queueID, websocket.CloseStatusGoingAway, "restarting")
+	waitFor(t, "reconnect", func() bool {
+		status, _ := consumer.Status(queueID)
+		return status.Reconnects == 1 && status.Connected
+	})
+	if err := producer.PublishMsg(queueID, "after reconnect"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case body := <-received:
+		if body != "after reconnect" {
+			t.Fatalf("received %q", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message after reconnect")
+	}
+
+	// CloseStatusPolicyViolation停止订阅
+	srv.CloseConsumers(queueID, websocket.CloseStatusPolicyViolation, "token revoked")
+	select {
+	case err := <-done:
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) {
+			t.Fatalf("SubscribeQueue returned %v, want *websocket.CloseError", err)
+		}
+		if closeErr.Code != websocket.CloseStatusPolicyViolation || closeErr.Text != "token revoked" {
+			t.Errorf("CloseError = %d %q", closeErr.Code, closeErr.Text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SubscribeQueue kept running after a policy violation close")
+	}
+	if _, ok := consumer.Status(queueID); ok {
+		t.Error("subscription still registered after a policy violation close")
+	}
+}
@@ -0,0 +1,149 @@
+package umq
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// KeyProvider 提供消息体加解密使用的AES密钥，密钥长度须为16、24或32字节
+// 轮换密钥时让CurrentKey返回新密钥，旧密钥须保留在Key中，直到用它加密的消息都已消费
+type KeyProvider interface {
+	// CurrentKey 返回加密新消息使用的密钥ID及密钥，密钥ID随消息发送
+	CurrentKey(ctx context.Context) (keyID string, key []byte, err error)
+	// Key 返回keyID对应的密钥，没有该密钥时返回ErrUnknownKey
+	Key(ctx context.Context, keyID string) ([]byte, error)
+}
+
+// ErrUnknownKey KeyProvider或KeySet中没有消息使用的密钥
+var ErrUnknownKey = errors.New("umq: unknown key")
+
+// DecryptError 消息解密失败，这类消息不会交给handler，按RejectPolicy处理
+type DecryptError struct {
+	KeyID string
+	Err   error
+}
+
+func (e *DecryptError) Error() string {
+	return fmt.Sprintf("umq: decrypt message with key %q: %v", e.KeyID, e.Err)
+}
+
+func (e *DecryptError) Unwrap() error {
+	return e.Err
+}
+
+// Keyring 内存中的KeyProvider，可在运行时添加密钥及切换当前密钥
+type Keyring struct {
+	mutex   sync.RWMutex
+	current string
+	keys    map[string][]byte
+}
+
+// NewKeyring 创建Keyring，currentID为加密新消息使用的密钥，必须在keys中
+func NewKeyring(currentID string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string][]byte, len(keys))}
+	for id, key := range keys {
+		if err := k.Add(id, key); err != nil {
+			return nil, err
+		}
+	}
+	if err := k.SetCurrent(currentID); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Add 添加或替换密钥，不改变当前密钥
+func (k *Keyring) Add(keyID string, key []byte) error {
+	if keyID == "" {
+		return errors.New("umq: empty key id")
+	}
+	if _, err := aes.NewCipher(key); err != nil {
+		return fmt.Errorf("umq: key %q: %v", keyID, err)
+	}
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.keys[keyID] = append([]byte(nil), key...)
+	return nil
+}
+
+// SetCurrent 切换加密新消息使用的密钥
+func (k *Keyring) SetCurrent(keyID string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if _, ok := k.keys[keyID]; !ok {
+		return fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	k.current = keyID
+	return nil
+}
+
+// Remove 删除不再使用的密钥，不能删除当前密钥
+func (k *Keyring) Remove(keyID string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if keyID == k.current {
+		return fmt.Errorf("umq: cannot remove current key %q", keyID)
+	}
+	delete(k.keys, keyID)
+	return nil
+}
+
+func (k *Keyring) CurrentKey(ctx context.Context) (string, []byte, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.current, k.keys[k.current], nil
+}
+
+func (k *Keyring) Key(ctx context.Context, keyID string) ([]byte, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// encryptionAAD 绑定到密文的附加数据，防止篡改密钥ID或消息体的编码、压缩标记
+func encryptionAAD(wire *envelope) []byte {
+	return []byte(fmt.Sprintf("umq/%d\x00%s\x00%s\x00%s", wire.Version, wire.KeyID, wire.Encoding, wire.Compression))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal 以AES-GCM加密plaintext，返回nonce及密文
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// open 解密seal的结果
+func open(key, sealed, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, aad)
+}
@@ -0,0 +1,323 @@
+package umq_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+	"github.com/ucloud/umq-sdk-go/umq/umqtest"
+)
+
+// testQueue umqtest.Server上的一个队列及其生产者、消费者角色，
+// 可用不同的配置分别创建生产者和消费者
+type testQueue struct {
+	srv                       *umqtest.Server
+	queueID                   string
+	producerID, producerToken string
+	consumerID, consumerToken string
+}
+
+func newTestQueue(t *testing.T) *testQueue {
+	srv := umqtest.NewServer()
+	t.Cleanup(srv.Close)
+	q := &testQueue{srv: srv, queueID: srv.CreateQueue("test", "Direct")}
+	q.producerID, q.producerToken = srv.CreateRole(q.queueID, "Pub")
+	q.consumerID, q.consumerToken = srv.CreateRole(q.queueID, "Sub")
+	return q
+}
+
+func (q *testQueue) client(t *testing.T, mod func(*umq.UmqConfig)) *umq.UmqClient {
+	config := q.srv.Config()
+	if mod != nil {
+		mod(&config)
+	}
+	client, err := umq.CreateClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func (q *testQueue) producer(t *testing.T, mod func(*umq.UmqConfig)) *umq.UmqProducer {
+	return q.client(t, mod).NewProducer(q.producerID, q.producerToken)
+}
+
+func (q *testQueue) consumer(t *testing.T, mod func(*umq.UmqConfig)) *umq.UmqConsumer {
+	return q.client(t, mod).NewConsumer(q.consumerID, q.consumerToken)
+}
+
+// rejectRecorder 记录RejectPolicy.OnReject收到的错误
+type rejectRecorder struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (r *rejectRecorder) onReject(queueID string, msg umq.Message, err error) {
+	r.mu.Lock()
+	r.errs = append(r.errs, err)
+	r.mu.Unlock()
+}
+
+func (r *rejectRecorder) take() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	errs := r.errs
+	r.errs = nil
+	return errs
+}
+
+func newTestKeyring(t *testing.T, current string, ids ...string) *umq.Keyring {
+	keys := make(map[string][]byte, len(ids))
+	for _, id := range ids {
+		keys[id] = bytes.Repeat([]byte(id[len(id)-1:]), 32)
+	}
+	k, err := umq.NewKeyring(current, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	q := newTestQueue(t)
+	keys := newTestKeyring(t, "k1", "k1")
+	rec := &contentRecorder{}
+	producer := q.producer(t, func(c *umq.UmqConfig) {
+		c.KeyProvider = keys
+		c.HTTPTransport = rec
+	})
+	consumer := q.consumer(t, func(c *umq.UmqConfig) { c.KeyProvider = keys })
+
+	const secret = "top secret payload"
+	envs := []umq.Envelope{
+		{Body: secret, ContentType: "text/plain"},
+		{Body: "\x00\xff binary", Binary: true},
+		{Body: strings.Repeat(secret, 100)},
+	}
+	for _, env := range envs {
+		if err := producer.PublishMessage(q.queueID, env); err != nil {
+			t.Fatal(err)
+		}
+		if content := rec.last(); strings.Contains(content, "secret") || !strings.Contains(content, `"kid":"k1"`) {
+			t.Errorf("Content = %s, want the encrypted body with its key id", content)
+		}
+	}
+	// 纯字符串消息同样加密
+	if err := producer.PublishMsg(q.queueID, secret); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(rec.last(), "secret") {
+		t.Errorf("PublishMsg sent the body in plaintext: %s", rec.last())
+	}
+	envs = append(envs, umq.Envelope{Body: secret})
+
+	info, err := consumer.GetMsg(q.queueID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Msgs) != len(envs) {
+		t.Fatalf("got %d messages, want %d", len(info.Msgs), len(envs))
+	}
+	for i, msg := range info.Msgs {
+		d := msg.Delivery()
+		if d.Body != envs[i].Body || d.Binary != envs[i].Binary || d.ContentType != envs[i].ContentType || d.KeyID != "k1" {
+			t.Errorf("message %d = %+v, want %+v encrypted with k1", i, d, envs[i])
+		}
+	}
+}
+
+func TestEncryptKeyRotation(t *testing.T) {
+	q := newTestQueue(t)
+	keys := newTestKeyring(t, "k1", "k1", "k2")
+	producer := q.producer(t, func(c *umq.UmqConfig) { c.KeyProvider = keys })
+	consumer := q.consumer(t, func(c *umq.UmqConfig) { c.KeyProvider = keys })
+
+	if err := producer.PublishMsg(q.queueID, "before"); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.SetCurrent("k2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := producer.PublishMsg(q.queueID, "after"); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan umq.Delivery, 2)
+	go consumer.SubscribeDelivery(q.queueID, func(c chan string, d umq.Delivery) {
+		received <- d
+		c <- d.MsgId
+	})
+	defer consumer.UnSubscribe(q.queueID)
+	got := map[string]string{}
+	for i := 0; i < 2; i++ {
+		select {
+		case d := <-received:
+			got[d.Body] = d.KeyID
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for messages")
+		}
+	}
+	if got["before"] != "k1" || got["after"] != "k2" {
+		t.Errorf("key ids = %v, want before with k1 and after with k2", got)
+	}
+}
+
+func TestEncryptTamperedHeader(t *testing.T) {
+	q := newTestQueue(t)
+	// k2与k1的密钥相同，改写kid后只有AAD能发现
+	key := bytes.Repeat([]byte{1}, 32)
+	keys, err := umq.NewKeyring("k1", map[string][]byte{"k1": key, "k2": key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &contentRecorder{}
+	producer := q.producer(t, func(c *umq.UmqConfig) {
+		c.KeyProvider = keys
+		c.HTTPTransport = rec
+	})
+	if err := producer.PublishMsg(q.queueID, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	content := rec.last()
+	prefix := `{"umq":1,`
+	if !strings.HasPrefix(content, prefix) || !strings.Contains(content, `"kid":"k1"`) {
+		t.Fatalf("unexpected Content %s", content)
+	}
+	// 密钥ID、编码及压缩标记由AAD保护，改动后即使密钥存在也无法解密
+	tampered := []string{
+		strings.Replace(content, `"kid":"k1"`, `"kid":"k2"`, 1),
+		prefix + `"enc":"base64url",` + content[len(prefix):],
+		prefix + `"z":"gzip",` + content[len(prefix):],
+	}
+	raw := q.producer(t, nil)
+	for _, c := range tampered {
+		if err := raw.PublishMsg(q.queueID, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rejects := &rejectRecorder{}
+	consumer := q.consumer(t, func(c *umq.UmqConfig) {
+		c.KeyProvider = keys
+		c.RejectPolicy = umq.RejectPolicy{Action: umq.RejectDrop, OnReject: rejects.onReject}
+	})
+	info, err := consumer.GetMsg(q.queueID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只有未经改动的原始消息能够解密
+	if len(info.Msgs) != 1 || info.Msgs[0].MsgBody != "hello" {
+		t.Fatalf("got %+v, want only the original message", info.Msgs)
+	}
+	errs := rejects.take()
+	if len(errs) != len(tampered) {
+		t.Fatalf("rejected %d messages, want %d", len(errs), len(tampered))
+	}
+	for i, err := range errs {
+		var decryptErr *umq.DecryptError
+		if !errors.As(err, &decryptErr) {
+			t.Errorf("tampered message %d: err = %v, want *DecryptError", i, err)
+		}
+	}
+}
+
+func TestDecryptMissingKeyRedelivered(t *testing.T) {
+	q := newTestQueue(t)
+	q.srv.SetAckTimeout(200 * time.Millisecond)
+	producer := q.producer(t, func(c *umq.UmqConfig) { c.KeyProvider = newTestKeyring(t, "k1", "k1") })
+	if err := producer.PublishMsg(q.queueID, "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 消费者尚未拿到k1，RejectNack不ack，消息在ack超时后重新投递
+	rejects := &rejectRecorder{}
+	stale := q.consumer(t, func(c *umq.UmqConfig) {
+		c.KeyProvider = newTestKeyring(t, "k2", "k2")
+		c.RejectPolicy = umq.RejectPolicy{Action: umq.RejectNack, OnReject: rejects.onReject}
+	})
+	info, err := stale.GetMsg(q.queueID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Msgs) != 0 {
+		t.Fatalf("message delivered without its key: %+v", info.Msgs)
+	}
+	errs := rejects.take()
+	var decryptErr *umq.DecryptError
+	if len(errs) != 1 || !errors.As(errs[0], &decryptErr) || decryptErr.KeyID != "k1" || !errors.Is(errs[0], umq.ErrUnknownKey) {
+		t.Fatalf("reject errors = %v, want a *DecryptError for k1 wrapping ErrUnknownKey", errs)
+	}
+	if stats := q.srv.Stats(q.queueID); stats.Acked != 0 {
+		t.Fatalf("stats = %+v, want the message left unacked", stats)
+	}
+
+	consumer := q.consumer(t, func(c *umq.UmqConfig) { c.KeyProvider = newTestKeyring(t, "k1", "k1", "k2") })
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info, err := consumer.GetMsg(q.queueID, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(info.Msgs) == 1 {
+			if d := info.Msgs[0].Delivery(); d.Body != "hello" || d.KeyID != "k1" {
+				t.Errorf("redelivered %+v", d)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("message was not redelivered")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	key1 := bytes.Repeat([]byte{1}, 16)
+	key2 := bytes.Repeat([]byte{2}, 32)
+	if _, err := umq.NewKeyring("k3", map[string][]byte{"k1": key1}); !errors.Is(err, umq.ErrUnknownKey) {
+		t.Errorf("NewKeyring with unknown current key: %v, want ErrUnknownKey", err)
+	}
+	if _, err := umq.NewKeyring("k1", map[string][]byte{"k1": key1[:10]}); err == nil {
+		t.Error("NewKeyring accepted a 10-byte key")
+	}
+
+	k, err := umq.NewKeyring("k1", map[string][]byte{"k1": key1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Add("", key2); err == nil {
+		t.Error("Add accepted an empty key id")
+	}
+	if err := k.Add("k2", key2); err != nil {
+		t.Fatal(err)
+	}
+	// Add保存密钥的副本
+	key2[0] = 0xff
+	if got, _ := k.Key(context.Background(), "k2"); got[0] != 2 {
+		t.Error("Keyring shares the caller's key slice")
+	}
+
+	if err := k.SetCurrent("k9"); !errors.Is(err, umq.ErrUnknownKey) {
+		t.Errorf("SetCurrent(k9) = %v, want ErrUnknownKey", err)
+	}
+	if id, _, _ := k.CurrentKey(context.Background()); id != "k1" {
+		t.Errorf("current key = %q after failed SetCurrent, want k1", id)
+	}
+	if err := k.Remove("k1"); err == nil {
+		t.Error("Remove deleted the current key")
+	}
+	if err := k.SetCurrent("k2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Remove("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Key(context.Background(), "k1"); !errors.Is(err, umq.ErrUnknownKey) {
+		t.Errorf("Key(k1) after Remove = %v, want ErrUnknownKey", err)
+	}
+}
@@ -0,0 +1,305 @@
+package umq
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// envelopeVersion SDK消息封装格式的版本号
+const envelopeVersion = 1
+
+// envelopePrefix 封装后消息体的固定前缀，用于快速区分普通字符串消息
+const envelopePrefix = `{"umq":`
+
+// encodingBase64 二进制消息体的编码，使用URL安全的字母表以免在查询串中被转义
+const encodingBase64 = "base64url"
+
+// base64Encoding 二进制消息体使用的base64编码
+var base64Encoding = base64.RawURLEncoding
+
+// Envelope SDK的消息封装，在Content中以带版本号的JSON发送
+// 消费者使用本SDK时会自动解封装，通过Message.Delivery获取各字段；
+// 其他客户端收到的是JSON字符串
+type Envelope struct {
+	// 消息内容
+	Body string
+	// 消息内容的类型，例如 application/json
+	ContentType string
+	// 关联ID，用于请求/响应等场景串联消息
+	CorrelationID string
+	// 路由键，供消费者按业务分发消息
+	RoutingKey string
+	// 幂等键，同一业务消息重发时保持不变，供消费者去重（见umqdedup）
+	IdempotencyKey string
+	// 发送时间，为零值时PublishMessage使用当前时间
+	Timestamp time.Time
+	// 自定义的头部，链路追踪的traceparent等同样写在这里
+	Headers map[string]string
+	// Body是否为任意二进制数据，为true时以base64编码发送，消费者收到的Body为原始字节
+	Binary bool
+}
+
+// envelope Envelope在Content中的JSON格式，字段名尽量短以减少消息体积
+type envelope struct {
+	Version        int               `json:"umq"`
+	ContentType    string            `json:"ct,omitempty"`
+	CorrelationID  string            `json:"cid,omitempty"`
+	RoutingKey     string            `json:"rk,omitempty"`
+	IdempotencyKey string            `json:"ik,omitempty"`
+	Timestamp      int64             `json:"ts,omitempty"` // unix毫秒
+	Headers        map[string]string `json:"h,omitempty"`
+	Encoding       string            `json:"enc,omitempty"`
+	Compression    string            `json:"z,omitempty"`
+	KeyID          string            `json:"kid,omitempty"`
+	SigAlgorithm   string            `json:"sa,omitempty"`
+	SigKeyID       string            `json:"sk,omitempty"`
+	Signature      string            `json:"sig,omitempty"`
+	Body           string            `json:"b"`
+}
+
+// encodeEnvelope 按Content的格式编码env，消息体达到阈值时按client.compression压缩，
+// 配置了KeyProvider时再加密，配置了Signer时最后签名。压缩或加密后的消息体总是以base64发送，
+// Encoding仍表示原始消息体是否为二进制
+func (client *UmqClient) encodeEnvelope(ctx context.Context, queueID string, env Envelope) (string, error) {
+	// 不是合法UTF-8的字符串在JSON中会被替换，按二进制发送以保留原始字节
+	if !env.Binary && !utf8.ValidString(env.Body) {
+		env.Binary = true
+	}
+	wire := envelope{
+		Version:        envelopeVersion,
+		ContentType:    env.ContentType,
+		CorrelationID:  env.CorrelationID,
+		RoutingKey:     env.RoutingKey,
+		IdempotencyKey: env.IdempotencyKey,
+		Headers:        env.Headers,
+		Body:           env.Body,
+	}
+	if !env.Timestamp.IsZero() {
+		wire.Timestamp = env.Timestamp.UnixMilli()
+	}
+	body := []byte(env.Body)
+	plainSize := len(body)
+	if env.Binary {
+		wire.Encoding = encodingBase64
+		plainSize = base64Encoding.EncodedLen(len(body))
+	}
+	if comp := client.compression; comp.shouldCompress(len(body)) {
+		compressor, ok := lookupCompressor(comp.Algorithm)
+		if !ok {
+			return "", fmt.Errorf("%w %q", ErrUnknownCompression, comp.Algorithm)
+		}
+		compressed, err := compressor.Compress(body, comp.Level)
+		if err != nil {
+			return "", err
+		}
+		// 压缩后加上base64反而更大时按原样发送
+		if base64Encoding.EncodedLen(len(compressed)) < plainSize {
+			wire.Compression = comp.Algorithm
+			body = compressed
+		}
+	}
+	if client.keys != nil {
+		keyID, key, err := client.keys.CurrentKey(ctx)
+		if err != nil {
+			return "", err
+		}
+		wire.KeyID = keyID
+		if body, err = seal(key, body, encryptionAAD(&wire)); err != nil {
+			return "", fmt.Errorf("umq: encrypt message with key %q: %v", keyID, err)
+		}
+	}
+	if env.Binary || wire.Compression != "" || wire.KeyID != "" {
+		wire.Body = base64Encoding.EncodeToString(body)
+	}
+	if client.signer != nil {
+		if err := client.sign(ctx, queueID, &wire); err != nil {
+			return "", fmt.Errorf("umq: sign message: %v", err)
+		}
+	}
+	buf, err := json.Marshal(wire)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// parseEnvelope 解析content中的封装，content不是可识别的封装时返回nil
+func parseEnvelope(content string) *envelope {
+	if !strings.HasPrefix(content, envelopePrefix) {
+		return nil
+	}
+	var wire envelope
+	if err := json.Unmarshal([]byte(content), &wire); err != nil {
+		return nil
+	}
+	if wire.Version < 1 || wire.Version > envelopeVersion {
+		return nil
+	}
+	// 无法识别的编码按普通字符串消息交给调用方
+	if wire.Encoding != "" && wire.Encoding != encodingBase64 {
+		return nil
+	}
+	return &wire
+}
+
+// decodeEnvelope 解析封装的消息体，content不是可识别的封装时env为nil
+// 配置了Verifier时先验证签名，失败时返回*SignatureError；加密的消息解密失败时返回*DecryptError；
+// 消息体无法base64解码或解压时返回*EnvelopeError。不是可识别封装的内容按普通字符串消息处理
+func (client *UmqClient) decodeEnvelope(ctx context.Context, queueID, content string) (env *Envelope, wire *envelope, err error) {
+	wire = parseEnvelope(content)
+	if client.verifier != nil {
+		if err := client.verify(ctx, queueID, wire); err != nil {
+			return nil, nil, err
+		}
+	}
+	if wire == nil {
+		return nil, nil, nil
+	}
+	binary := wire.Encoding == encodingBase64
+	body := wire.Body
+	if binary || wire.Compression != "" || wire.KeyID != "" {
+		raw, err := base64Encoding.DecodeString(wire.Body)
+		if err != nil {
+			return nil, nil, &EnvelopeError{Compression: wire.Compression, Err: err}
+		}
+		if wire.KeyID != "" {
+			if raw, err = client.decrypt(ctx, wire, raw); err != nil {
+				return nil, nil, &DecryptError{KeyID: wire.KeyID, Err: err}
+			}
+		}
+		if wire.Compression != "" {
+			compressor, ok := lookupCompressor(wire.Compression)
+			if !ok {
+				return nil, nil, &EnvelopeError{Compression: wire.Compression, Err: ErrUnknownCompression}
+			}
+			if raw, err = compressor.Decompress(raw, MaxDecompressedSize); err != nil {
+				return nil, nil, &EnvelopeError{Compression: wire.Compression, Err: err}
+			}
+		}
+		body = string(raw)
+	}
+	env = &Envelope{
+		Body:           body,
+		ContentType:    wire.ContentType,
+		CorrelationID:  wire.CorrelationID,
+		RoutingKey:     wire.RoutingKey,
+		IdempotencyKey: wire.IdempotencyKey,
+		Headers:        wire.Headers,
+		Binary:         binary,
+	}
+	if wire.Timestamp != 0 {
+		env.Timestamp = time.UnixMilli(wire.Timestamp)
+	}
+	return env, wire, nil
+}
+
+// decrypt 使用wire.KeyID对应的密钥解密body
+func (client *UmqClient) decrypt(ctx context.Context, wire *envelope, body []byte) ([]byte, error) {
+	if client.keys == nil {
+		return nil, errors.New("no KeyProvider configured")
+	}
+	key, err := client.keys.Key(ctx, wire.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	return open(key, body, encryptionAAD(wire))
+}
+
+// unwrap 若消息体是SDK封装格式则还原为原始内容，并保留封装的各字段
+// 签名验证、解密或解压失败时返回错误，消息保持不变
+func (client *UmqClient) unwrap(ctx context.Context, queueID string, msg *Message) error {
+	env, wire, err := client.decodeEnvelope(ctx, queueID, msg.MsgBody)
+	if err != nil {
+		return err
+	}
+	if env != nil {
+		msg.MsgBody = env.Body
+		msg.env = env
+		msg.keyID = wire.KeyID
+		if client.verifier != nil {
+			msg.signKeyID = wire.SigKeyID
+		}
+	}
+	return nil
+}
+
+// headers 返回封装中的头部，消息未经封装时为nil
+func (msg Message) headers() map[string]string {
+	if msg.env == nil {
+		return nil
+	}
+	return msg.env.Headers
+}
+
+// Delivery 消费者收到的一条消息及其封装信息
+type Delivery struct {
+	MsgId string
+	Envelope
+	// 消息是否为SDK封装格式，普通字符串消息为false，此时只有Body有值
+	Enveloped bool
+	// 消息加密使用的密钥ID，未加密时为空
+	KeyID string
+	// 签名验证通过时为签名的密钥ID，未配置Verifier时为空
+	SignatureKeyID string
+
+	ctx context.Context
+}
+
+// Delivery 返回消息的封装信息，普通字符串消息同样可用
+func (msg Message) Delivery() Delivery {
+	d := Delivery{MsgId: msg.MsgId, KeyID: msg.keyID, SignatureKeyID: msg.signKeyID, ctx: msg.ctx}
+	if msg.env != nil {
+		d.Envelope = *msg.env
+		d.Enveloped = true
+	} else {
+		d.Body = msg.MsgBody
+	}
+	return d
+}
+
+// Bytes 以[]byte返回消息内容，适用于PublishBytes发送的二进制消息
+func (d Delivery) Bytes() []byte {
+	return []byte(d.Body)
+}
+
+// Context 同Message.Context
+func (d Delivery) Context() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
+// DeliveryHandler SubscribeDelivery使用的回调函数，channel c的用法与MsgHandler相同
+type DeliveryHandler func(c chan string, d Delivery)
+
+// SubscribeDelivery 同SubscribeQueue，消息以Delivery的形式回调
+func (consumer *UmqConsumer) SubscribeDelivery(queueId string, handler DeliveryHandler) error {
+	return consumer.SubscribeQueue(queueId, func(c chan string, msg Message) {
+		handler(c, msg.Delivery())
+	})
+}
+
+// BytesHandler SubscribeBytes使用的回调函数，channel c的用法与MsgHandler相同
+type BytesHandler func(c chan string, msgId string, payload []byte)
+
+// SubscribeBytes 同SubscribeQueue，消息内容以[]byte回调
+// PublishBytes发送的消息会还原为原始字节，其他消息按字符串的字节回调
+func (consumer *UmqConsumer) SubscribeBytes(queueId string, handler BytesHandler) error {
+	return consumer.SubscribeQueue(queueId, func(c chan string, msg Message) {
+		handler(c, msg.MsgId, []byte(msg.MsgBody))
+	})
+}
+
+// EncodedBytesSize 返回PublishBytes发送size字节时Content的长度，可用于估算base64及封装带来的开销
+// 包含自动生成的幂等键，不包含Tracer写入的头部，也不考虑压缩、加密及签名
+func EncodedBytesSize(size int) int {
+	return len(envelopePrefix) + len(`1,"ik":"`) + base64Encoding.EncodedLen(16) +
+		len(`","enc":"`+encodingBase64+`","b":""}`) + base64Encoding.EncodedLen(size)
+}
@@ -0,0 +1,242 @@
+package umq_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+	"github.com/ucloud/umq-sdk-go/umq/umqtest"
+)
+
+// newTestClient 在umqtest.Server上创建队列及生产者、消费者，mod可修改client的配置
+func newTestClient(t *testing.T, mod func(*umq.UmqConfig)) (*umqtest.Server, *umq.UmqProducer, *umq.UmqConsumer, string) {
+	srv := umqtest.NewServer()
+	t.Cleanup(srv.Close)
+	queueID := srv.CreateQueue("test", "Direct")
+	producerID, producerToken := srv.CreateRole(queueID, "Pub")
+	consumerID, consumerToken := srv.CreateRole(queueID, "Sub")
+	config := srv.Config()
+	if mod != nil {
+		mod(&config)
+	}
+	client, err := umq.CreateClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, client.NewProducer(producerID, producerToken), client.NewConsumer(consumerID, consumerToken), queueID
+}
+
+// contentRecorder 记录发布请求的Content参数，GET及POST请求均可
+type contentRecorder struct {
+	mu       sync.Mutex
+	contents []string
+}
+
+func (r *contentRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	content := req.URL.Query().Get("Content")
+	if req.Method == http.MethodPost {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		var params map[string]string
+		json.Unmarshal(body, &params)
+		content = params["Content"]
+	}
+	if content != "" {
+		r.mu.Lock()
+		r.contents = append(r.contents, content)
+		r.mu.Unlock()
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (r *contentRecorder) last() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.contents[len(r.contents)-1]
+}
+
+func TestBytesRoundTrip(t *testing.T) {
+	_, producer, consumer, queueID := newTestClient(t, nil)
+
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	payloads := [][]byte{
+		{},
+		all,
+		// 不合法的UTF-8: 孤立的续字节、截断的多字节序列、代理区、超长编码
+		{0x80},
+		{0xe2, 0x82},
+		{'a', 0xff, 'b'},
+		{0xed, 0xa0, 0x80},
+		{0xc0, 0xaf},
+		{0xf4, 0x90, 0x80, 0x80},
+		[]byte(`{"umq":1,"b":"looks like an envelope"}`),
+	}
+	for i := 0; i < 256; i++ {
+		payloads = append(payloads, []byte{byte(i)})
+	}
+	for _, p := range payloads {
+		if err := producer.PublishBytes(queueID, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	received := make(chan []byte, len(payloads))
+	go consumer.SubscribeBytes(queueID, func(c chan string, msgId string, payload []byte) {
+		received <- payload
+		c <- msgId
+	})
+	defer consumer.UnSubscribe(queueID)
+
+	want := map[string]int{}
+	for _, p := range payloads {
+		want[string(p)]++
+	}
+	timeout := time.After(10 * time.Second)
+	for range payloads {
+		select {
+		case p := <-received:
+			if want[string(p)] == 0 {
+				t.Fatalf("unexpected payload %x", p)
+			}
+			want[string(p)]--
+		case <-timeout:
+			t.Fatal("timed out waiting for messages")
+		}
+	}
+}
+
+func TestEncodedBytesSize(t *testing.T) {
+	rec := &contentRecorder{}
+	_, producer, _, queueID := newTestClient(t, func(c *umq.UmqConfig) {
+		c.HTTPTransport = rec
+	})
+	for _, size := range []int{0, 1, 2, 3, 4, 5, 100, 1023, 4096, 10000} {
+		payload := bytes.Repeat([]byte{0xff}, size)
+		if err := producer.PublishBytes(queueID, payload); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(rec.last()), umq.EncodedBytesSize(size); got != want {
+			t.Errorf("size %d: Content is %d bytes, EncodedBytesSize = %d", size, got, want)
+		}
+	}
+}
+
+func TestPlainMessageSentUnwrapped(t *testing.T) {
+	rec := &contentRecorder{}
+	_, producer, _, queueID := newTestClient(t, func(c *umq.UmqConfig) {
+		c.HTTPTransport = rec
+	})
+	if err := producer.PublishMsg(queueID, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.last(); got != "hello" {
+		t.Errorf("Content = %q, want the body without an envelope", got)
+	}
+}
+
+func TestDeliveryPlainMessage(t *testing.T) {
+	_, producer, consumer, queueID := newTestClient(t, nil)
+	bodies := []string{"hello", `{"not":"an envelope"}`, ""}
+	for _, body := range bodies {
+		if err := producer.PublishMsg(queueID, body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	received := make(chan umq.Delivery, len(bodies))
+	go consumer.SubscribeDelivery(queueID, func(c chan string, d umq.Delivery) {
+		received <- d
+		c <- d.MsgId
+	})
+	defer consumer.UnSubscribe(queueID)
+	for _, body := range bodies {
+		select {
+		case d := <-received:
+			if d.MsgId == "" || d.Enveloped || d.KeyID != "" || d.SignatureKeyID != "" ||
+				!reflect.DeepEqual(d.Envelope, umq.Envelope{Body: body}) {
+				t.Errorf("Delivery = %+v, want only Body %q", d, body)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+	}
+}
+
+func TestDeliveryEnvelopeRoundTrip(t *testing.T) {
+	_, producer, consumer, queueID := newTestClient(t, nil)
+	envs := []umq.Envelope{
+		{
+			Body:           `{"order":1}`,
+			ContentType:    "application/json",
+			CorrelationID:  "corr-1",
+			RoutingKey:     "orders.created",
+			IdempotencyKey: "order-1",
+			// 时间戳以毫秒精度发送
+			Timestamp: time.UnixMilli(1700000000123),
+			Headers:   map[string]string{"tenant": "a", "x-retry": "0"},
+		},
+		{
+			Body:           "\x00\xff\xfe",
+			IdempotencyKey: "bin-1",
+			Timestamp:      time.UnixMilli(1700000000456),
+			Binary:         true,
+		},
+	}
+	check := func(method string, got umq.Delivery, want umq.Envelope) {
+		t.Helper()
+		got.Timestamp = got.Timestamp.Local()
+		if !got.Enveloped || !reflect.DeepEqual(got.Envelope, want) {
+			t.Errorf("%s: Delivery = %+v, want %+v", method, got, want)
+		}
+	}
+
+	for _, env := range envs {
+		if err := producer.PublishMessage(queueID, env); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := consumer.GetMsg(queueID, len(envs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Msgs) != len(envs) {
+		t.Fatalf("GetMsg returned %d messages, want %d", len(info.Msgs), len(envs))
+	}
+	for i, msg := range info.Msgs {
+		check("GetMsg", msg.Delivery(), envs[i])
+		if err := consumer.AckMsg(queueID, msg.MsgId); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, env := range envs {
+		if err := producer.PublishMessage(queueID, env); err != nil {
+			t.Fatal(err)
+		}
+	}
+	received := make(chan umq.Delivery, len(envs))
+	go consumer.SubscribeDelivery(queueID, func(c chan string, d umq.Delivery) {
+		received <- d
+		c <- d.MsgId
+	})
+	defer consumer.UnSubscribe(queueID)
+	for _, env := range envs {
+		select {
+		case d := <-received:
+			check("SubscribeDelivery", d, env)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+	}
+}
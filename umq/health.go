@@ -0,0 +1,126 @@
+package umq
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// DefaultHealthCheckTimeout HealthHandler检查API连通性的超时时间
+const DefaultHealthCheckTimeout = 5 * time.Second
+
+// HealthCheck 检查UMQ接入点是否可达，并通过GetOrganizationId验证账户信息
+func (client *UmqClient) HealthCheck(ctx context.Context) error {
+	_, err := getOrganizationId(ctx, client.httpClient, client.httpAddr, client.email, client.projectID,
+		client.publicKey, client.privateKey)
+	return err
+}
+
+// SubscriptionStatus 订阅的运行状态
+type SubscriptionStatus struct {
+	QueueId string
+	// websocket连接当前是否可用
+	Connected bool
+	// 最近一次建立连接的时间
+	LastConnTime time.Time
+	// 最近一次收到消息的时间，尚未收到消息时为零值
+	LastMessageTime time.Time
+	// 最近一次连接断开或重连失败的原因
+	LastError string `json:",omitempty"`
+	// 当前连续重连失败的次数，连接成功后清零
+	ReconnectAttempts int
+	// 累计重连成功的次数
+	Reconnects int
+}
+
+func (info *subscribeInfo) status(queueId string) SubscriptionStatus {
+	info.mutex.Lock()
+	defer info.mutex.Unlock()
+	status := SubscriptionStatus{
+		QueueId:           queueId,
+		Connected:         info.connected && info.subscribe,
+		LastConnTime:      info.lastConnTime,
+		LastMessageTime:   info.lastMsgTime,
+		ReconnectAttempts: int(info.retryConnTimes),
+		Reconnects:        info.reconnects,
+	}
+	if info.lastErr != nil {
+		status.LastError = redactString(info.lastErr.Error())
+	}
+	return status
+}
+
+// Status 返回queueId对应订阅的状态，未订阅时ok为false
+func (consumer *UmqConsumer) Status(queueId string) (status SubscriptionStatus, ok bool) {
+	consumer.mutex.Lock()
+	info, ok := consumer.subInfo[queueId]
+	consumer.mutex.Unlock()
+	if !ok {
+		return status, false
+	}
+	return info.status(queueId), true
+}
+
+// Statuses 返回所有订阅的状态，按QueueId排序
+func (consumer *UmqConsumer) Statuses() []SubscriptionStatus {
+	consumer.mutex.Lock()
+	infos := make(map[string]*subscribeInfo, len(consumer.subInfo))
+	for queueId, info := range consumer.subInfo {
+		infos[queueId] = info
+	}
+	consumer.mutex.Unlock()
+
+	statuses := make([]SubscriptionStatus, 0, len(infos))
+	for queueId, info := range infos {
+		statuses = append(statuses, info.status(queueId))
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].QueueId < statuses[j].QueueId
+	})
+	return statuses
+}
+
+// HealthReport HealthHandler返回的JSON内容
+type HealthReport struct {
+	// API可达且所有订阅均已连接
+	Healthy       bool
+	API           APIHealth
+	Subscriptions []SubscriptionStatus
+}
+
+// APIHealth HealthCheck的结果
+type APIHealth struct {
+	Healthy bool
+	Error   string `json:",omitempty"`
+}
+
+// HealthHandler 以JSON返回client的API连通性及consumers中所有订阅的状态
+// 健康时返回200，否则返回503，可直接用于Kubernetes的readiness探针
+func HealthHandler(client *UmqClient, consumers ...*UmqConsumer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DefaultHealthCheckTimeout)
+		defer cancel()
+
+		report := HealthReport{Subscriptions: []SubscriptionStatus{}}
+		if err := client.HealthCheck(ctx); err != nil {
+			report.API.Error = redactString(err.Error())
+		} else {
+			report.API.Healthy = true
+		}
+		report.Healthy = report.API.Healthy
+		for _, consumer := range consumers {
+			for _, status := range consumer.Statuses() {
+				report.Healthy = report.Healthy && status.Connected
+				report.Subscriptions = append(report.Subscriptions, status)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,120 @@
+package umq_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+	"github.com/ucloud/umq-sdk-go/umq/umqtest"
+)
+
+// getHealth 请求HealthHandler并解析返回的JSON
+func getHealth(t *testing.T, h http.Handler) (int, umq.HealthReport, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var report umq.HealthReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &raw)
+	return rec.Code, report, raw
+}
+
+func TestHealthHandler(t *testing.T) {
+	srv := umqtest.NewServer()
+	defer srv.Close()
+	queueID := srv.CreateQueue("test", "Direct")
+	consumerID, consumerToken := srv.CreateRole(queueID, "Sub")
+	client, err := umq.CreateClient(srv.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.HealthCheck(context.Background()); err != nil {
+		t.Fatalf("HealthCheck = %v", err)
+	}
+	consumer := client.NewConsumer(consumerID, consumerToken)
+	if _, ok := consumer.Status(queueID); ok {
+		t.Error("Status reports a subscription before SubscribeQueue")
+	}
+	go consumer.SubscribeQueue(queueID, func(c chan string, msg umq.Message) { c <- msg.MsgId })
+	waitFor(t, "subscription to connect", func() bool {
+		status, ok := consumer.Status(queueID)
+		return ok && status.Connected
+	})
+
+	code, report, raw := getHealth(t, umq.HealthHandler(client, consumer))
+	if code != http.StatusOK || !report.Healthy || !report.API.Healthy || report.API.Error != "" {
+		t.Errorf("healthy report = %d %+v", code, report)
+	}
+	if len(report.Subscriptions) != 1 || report.Subscriptions[0].QueueId != queueID || !report.Subscriptions[0].Connected {
+		t.Errorf("Subscriptions = %+v", report.Subscriptions)
+	}
+	for _, key := range []string{"Healthy", "API", "Subscriptions"} {
+		if _, ok := raw[key]; !ok {
+			t.Errorf("JSON has no %s field: %v", key, raw)
+		}
+	}
+	sub := raw["Subscriptions"].([]any)[0].(map[string]any)
+	if _, ok := sub["LastError"]; ok {
+		t.Errorf("LastError present without an error: %v", sub)
+	}
+	if _, ok := raw["API"].(map[string]any)["Error"]; ok {
+		t.Errorf("API.Error present without an error: %v", raw["API"])
+	}
+
+	// 订阅已停止，连接状态不再可用
+	consumer.UnSubscribe(queueID)
+	if _, ok := consumer.Status(queueID); ok {
+		t.Error("Status reports a subscription after UnSubscribe")
+	}
+	code, report, raw = getHealth(t, umq.HealthHandler(client))
+	if code != http.StatusOK || len(report.Subscriptions) != 0 {
+		t.Errorf("report without consumers = %d %+v", code, report)
+	}
+	if subs, ok := raw["Subscriptions"].([]any); !ok || len(subs) != 0 {
+		t.Errorf("Subscriptions = %v, want an empty array", raw["Subscriptions"])
+	}
+}
+
+func TestHealthHandlerAPIFailure(t *testing.T) {
+	srv := umqtest.NewServer()
+	client, err := umq.CreateClient(srv.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+	if err := client.HealthCheck(context.Background()); err == nil {
+		t.Fatal("HealthCheck succeeded after the server closed")
+	}
+	code, report, _ := getHealth(t, umq.HealthHandler(client))
+	if code != http.StatusServiceUnavailable || report.Healthy || report.API.Healthy || report.API.Error == "" {
+		t.Errorf("report = %d %+v, want 503 with the API error", code, report)
+	}
+}
+
+// Status与UnSubscribe并发时不应有数据竞争，需配合-race运行
+func TestStatusDuringUnSubscribe(t *testing.T) {
+	_, _, consumer, queueID := newTestClient(t, nil)
+	go consumer.SubscribeQueue(queueID, func(c chan string, msg umq.Message) { c <- msg.MsgId })
+	waitFor(t, "subscription", func() bool {
+		_, ok := consumer.Status(queueID)
+		return ok
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			consumer.Statuses()
+		}
+	}()
+	consumer.UnSubscribe(queueID)
+	<-done
+}
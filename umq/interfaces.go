@@ -0,0 +1,47 @@
+package umq
+
+import "context"
+
+// Publisher 发布消息，由UmqProducer实现
+type Publisher interface {
+	PublishMsg(queueID, content string) error
+	PublishMsgContext(ctx context.Context, queueID, content string) error
+	PublishMsgResult(ctx context.Context, queueID, content string) (PublishResult, error)
+	PublishMessage(queueID string, env Envelope) error
+	PublishMessageContext(ctx context.Context, queueID string, env Envelope) error
+	PublishMessageResult(ctx context.Context, queueID string, env Envelope) (PublishResult, error)
+	PublishBytes(queueID string, payload []byte) error
+	PublishBytesContext(ctx context.Context, queueID string, payload []byte) error
+}
+
+// Subscriber 订阅或拉取消息，由UmqConsumer实现
+type Subscriber interface {
+	SubscribeQueue(queueId string, msgHandler MsgHandler) error
+	SubscribeDelivery(queueId string, handler DeliveryHandler) error
+	SubscribeBytes(queueId string, handler BytesHandler) error
+	UnSubscribe(queueId string) error
+	GetMsg(queueId string, num int) (*MessageInfo, error)
+	GetMsgContext(ctx context.Context, queueId string, num int) (*MessageInfo, error)
+}
+
+// Acker 确认消息，由UmqConsumer实现
+type Acker interface {
+	AckMsg(queueId, msgId string) error
+	AckMsgContext(ctx context.Context, queueId, msgId string) error
+}
+
+// QueueAdmin 管理队列及角色，由UmqClient实现
+type QueueAdmin interface {
+	CreateQueue(projectID, couponID, remark, queueName, pushType, qos string) (interface{}, error)
+	DeleteQueue(queueId string, projectId string) (interface{}, error)
+	ListQueue(limit int, offset int, projectId string) (interface{}, error)
+	CreateRole(queueId string, num int, role string, projectId string) (interface{}, error)
+	DeleteRole(queueId string, roleId string, role string) (interface{}, error)
+}
+
+var (
+	_ Publisher  = (*UmqProducer)(nil)
+	_ Subscriber = (*UmqConsumer)(nil)
+	_ Acker      = (*UmqConsumer)(nil)
+	_ QueueAdmin = (*UmqClient)(nil)
+)
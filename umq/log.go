@@ -0,0 +1,120 @@
+package umq
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// redacted 替换敏感字段的值
+const redacted = "[REDACTED]"
+
+// isSecretKey 判断日志字段名是否为敏感信息，例如PrivateKey、ConsumerToken、Signature
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	return strings.Contains(key, "privatekey") ||
+		strings.Contains(key, "token") ||
+		strings.Contains(key, "signature") ||
+		strings.Contains(key, "secret")
+}
+
+// secretQuery 匹配URL查询串中的敏感参数，net/http的错误信息中会带有完整的请求URL
+var secretQuery = regexp.MustCompile(`(?i)\b(\w*(?:PrivateKey|Token|Signature|Secret)=)[^&\s"]*`)
+
+func redactString(s string) string {
+	return secretQuery.ReplaceAllString(s, "${1}"+redacted)
+}
+
+// redactHandler 在交给下游Handler之前去除日志中的敏感信息
+type redactHandler struct {
+	next slog.Handler
+}
+
+func newRedactHandler(next slog.Handler) slog.Handler {
+	return &redactHandler{next: next}
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, redactString(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clean := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		clean[i] = redactAttr(a)
+	}
+	return &redactHandler{next: h.next.WithAttrs(clean)}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{next: h.next.WithGroup(name)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	if isSecretKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindGroup:
+		group := v.Group()
+		clean := make([]any, len(group))
+		for i, ga := range group {
+			clean[i] = redactAttr(ga)
+		}
+		return slog.Group(a.Key, clean...)
+	case slog.KindString:
+		return slog.String(a.Key, redactString(v.String()))
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, redactString(err.Error()))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// discardHandler 未配置Logger时丢弃所有日志
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// paramsAttr 将请求参数转换为按键排序的日志字段组，消息内容只记录长度，
+// 未启用加密时Content即为消息明文
+func paramsAttr(params map[string]string) slog.Attr {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]any, len(keys))
+	for i, k := range keys {
+		if k == "Content" {
+			attrs[i] = slog.Int("ContentLength", len(params[k]))
+			continue
+		}
+		attrs[i] = slog.String(k, params[k])
+	}
+	return slog.Group("params", attrs...)
+}
+
+// logRequest 以Debug级别记录一次数据面请求
+func (client *UmqClient) logRequest(params map[string]string) {
+	if !client.logger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	client.logger.Debug("umq request", slog.String("action", params["Action"]), paramsAttr(params))
+}
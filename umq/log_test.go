@@ -0,0 +1,81 @@
+package umq
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// newTestLogger 返回经过redactHandler的Logger及其输出
+func newTestLogger() (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	h := slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	return slog.New(newRedactHandler(h)), &buf
+}
+
+func TestRedactString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"no secrets here", "no secrets here"},
+		{
+			`Get "http://api/?Action=PublishMsg&ProducerToken=abc&QueueId=q": EOF`,
+			`Get "http://api/?Action=PublishMsg&ProducerToken=[REDACTED]&QueueId=q": EOF`,
+		},
+		{
+			"https://api/?PrivateKey=k1&Signature=s1&ConsumerToken=t1",
+			"https://api/?PrivateKey=[REDACTED]&Signature=[REDACTED]&ConsumerToken=[REDACTED]",
+		},
+		{"token=lower", "token=[REDACTED]"},
+	}
+	for _, tt := range tests {
+		if got := redactString(tt.in); got != tt.want {
+			t.Errorf("redactString(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactHandler(t *testing.T) {
+	logger, buf := newTestLogger()
+	urlErr := errors.New(`Get "http://api/?Action=GetMsg&ConsumerToken=tok-err": timeout`)
+	logger.With("PrivateKey", "key-with").
+		WithGroup("req").
+		Info("request failed Signature=sig-msg",
+			"ProducerToken", "tok-attr",
+			slog.Group("params", "Signature", "sig-group", "QueueId", "queue-1"),
+			"error", urlErr,
+			"url", "http://api/?PublicKey=pub&PrivateKey=key-url",
+		)
+	out := buf.String()
+	for _, secret := range []string{"key-with", "tok-attr", "sig-group", "tok-err", "key-url", "sig-msg"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log contains %q: %s", secret, out)
+		}
+	}
+	for _, keep := range []string{"queue-1", "PublicKey=pub", "req.params.QueueId", "timeout"} {
+		if !strings.Contains(out, keep) {
+			t.Errorf("log lost %q: %s", keep, out)
+		}
+	}
+}
+
+func TestLogRequestOmitsContent(t *testing.T) {
+	logger, buf := newTestLogger()
+	client := &UmqClient{logger: logger}
+	client.logRequest(map[string]string{
+		"Action":        "PublishMsg",
+		"QueueId":       "q",
+		"Content":       "plaintext body",
+		"ProducerToken": "tok",
+	})
+	out := buf.String()
+	if strings.Contains(out, "plaintext body") || !strings.Contains(out, "ProducerToken=[REDACTED]") {
+		t.Errorf("log contains the message body or token: %s", out)
+	}
+	if !strings.Contains(out, "params.ContentLength=14") || !strings.Contains(out, "action=PublishMsg") {
+		t.Errorf("log = %s", out)
+	}
+}
@@ -0,0 +1,33 @@
+package umq
+
+import "time"
+
+// Metrics SDK的指标回调接口，通过UmqConfig.Metrics设置
+// 所有方法都可能被并发调用，且不应阻塞
+type Metrics interface {
+	// PublishDone 一次PublishMsg完成，err为nil表示成功
+	PublishDone(queueID string, duration time.Duration, err error)
+	// MessageReceived 订阅收到一条消息
+	MessageReceived(queueID string)
+	// HandlerDone MsgHandler一次调用返回
+	HandlerDone(queueID string, duration time.Duration)
+	// AckDone 一次AckMsg完成，err为nil表示成功
+	AckDone(queueID string, duration time.Duration, err error)
+	// Reconnected 订阅断开后重新连接成功
+	Reconnected(queueID string)
+	// ConnectionState 订阅的websocket连接状态变化
+	ConnectionState(queueID string, connected bool)
+	// InFlight 已收到但尚未ack的消息数变化
+	InFlight(queueID string, delta int)
+}
+
+// nopMetrics 未配置Metrics时使用的空实现
+type nopMetrics struct{}
+
+func (nopMetrics) PublishDone(string, time.Duration, error) {}
+func (nopMetrics) MessageReceived(string)                   {}
+func (nopMetrics) HandlerDone(string, time.Duration)        {}
+func (nopMetrics) AckDone(string, time.Duration, error)     {}
+func (nopMetrics) Reconnected(string)                       {}
+func (nopMetrics) ConnectionState(string, bool)             {}
+func (nopMetrics) InFlight(string, int)                     {}
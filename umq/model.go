@@ -1,5 +1,14 @@
 package umq
 
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
 // MsgHandler 订阅函数使用的回调函数
 // 其中 channel c 用来ack这条消息，一个常见的MsgHandler的实现如下
 //   func handleMessage(c chan string, msg Message) {
@@ -18,6 +27,21 @@ type MessageInfo struct {
 type Message struct {
 	MsgId   string `json:"MsgId"`
 	MsgBody string `json:"MsgBody"`
+
+	ctx   context.Context
+	env   *Envelope
+	keyID string
+	// 签名验证通过时为签名的密钥ID
+	signKeyID string
+}
+
+// Context 返回处理该消息的上下文
+// 配置了Tracer时，MsgHandler中的Context携带本次处理的span；SubscribeQueue投递的消息在取消订阅后Context被取消
+func (msg Message) Context() context.Context {
+	if msg.ctx == nil {
+		return context.Background()
+	}
+	return msg.ctx
 }
 
 // Role 角色的结构体
@@ -51,6 +75,24 @@ type UmqClient struct {
 	privateKey     string
 	projectID      string // 这个是缓存的project id
 	organizationID string // 这个是转换出来的数字的org id
+
+	apiURL           string
+	apiClient        *http.Client
+	httpClient       *http.Client
+	tlsConfig        *tls.Config
+	handshakeTimeout time.Duration
+	dialer           *net.Dialer
+	dialWebsocket    WebsocketDialFunc
+	metrics          Metrics
+	tracer           Tracer
+	logger           *slog.Logger
+	compression      Compression
+	request          dataRequest
+	keys             KeyProvider
+	signer           Signer
+	verifier         Verifier
+	rejectPolicy     RejectPolicy
+	publishRetry     RetryPolicy
 }
 
 // UmqProducer UMQ生产者的实例
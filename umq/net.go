@@ -2,9 +2,10 @@ package umq
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
+	"crypto/tls"
 	"encoding/hex"
-	"encoding/json"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -16,57 +17,72 @@ import (
 var client *http.Client
 
 func init() {
-	client = newTimeoutHTTPClient(time.Duration(10) * time.Second)
+	client = newTimeoutHTTPClient(time.Duration(10)*time.Second, nil)
 }
 
-func postHTTPRequest(url string, params map[string]string) (res []byte, err error) {
+// postHTTPRequestContext POST JSON格式的bodyBuf，返回HTTP状态码及回包
+func postHTTPRequestContext(ctx context.Context, httpClient *http.Client, url string, bodyBuf []byte) (status int, res []byte, err error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(bodyBuf))
 	if err != nil {
 		return
 	}
-	bodyBuf, err := json.Marshal(params)
-	if err != nil {
-		return
-	}
-	outputBuf := bytes.NewReader(bodyBuf)
-	result, err := client.Post(url, "application/json", outputBuf)
-	if err != nil {
-		return
-	}
-	defer result.Body.Close()
-	res, err = ioutil.ReadAll(result.Body)
+	httpReq.Header.Set("Content-Type", "application/json")
+	return doHTTPRequest(httpClient, httpReq)
+}
+
+func sendHTTPRequest(httpClient *http.Client, url string, params map[string]string, timeout uint32) (res []byte, err error) {
+	return sendHTTPRequestContext(context.Background(), httpClient, url, params, timeout)
+}
+
+// sendHTTPRequestContext 同sendHTTPRequest，ctx结束时取消请求
+func sendHTTPRequestContext(ctx context.Context, httpClient *http.Client, url string, params map[string]string, timeout uint32) (res []byte, err error) {
+	_, res, err = getHTTPRequestContext(ctx, httpClient, buildQueryURL(url, params))
 	return
 }
 
-func sendHTTPRequest(url string, params map[string]string, timeout uint32) (res []byte, err error) {
+// buildQueryURL 把params编码进url的查询串，url无法解析时原样返回，由发送请求时报错
+func buildQueryURL(url string, params map[string]string) string {
 	req, err := urlLib.Parse(url)
 	if err != nil {
-		return
+		return url
 	}
-
 	reqQuery := req.Query()
 	for k, v := range params {
 		reqQuery.Set(k, v)
 	}
 	req.RawQuery = reqQuery.Encode()
-	result, err := client.Get(req.String())
+	return req.String()
+}
+
+// getHTTPRequestContext GET完整的url，返回HTTP状态码及回包
+func getHTTPRequestContext(ctx context.Context, httpClient *http.Client, url string) (status int, res []byte, err error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return
+	}
+	return doHTTPRequest(httpClient, httpReq)
+}
+
+func doHTTPRequest(httpClient *http.Client, httpReq *http.Request) (status int, res []byte, err error) {
+	result, err := httpClient.Do(httpReq)
 	if err != nil {
 		return
 	}
 	defer result.Body.Close()
 	res, err = ioutil.ReadAll(result.Body)
-	return
+	return result.StatusCode, res, err
 }
 
-func sendAPIHttpRequest(params map[string]string, privateKey string, timeout uint32) (res []byte, err error) {
+func sendAPIHttpRequest(httpClient *http.Client, url string, params map[string]string, privateKey string, timeout uint32) (res []byte, err error) {
 	sign := signParams(params, privateKey)
 	params["Signature"] = sign
-	return sendHTTPRequest("https://api.ucloud.cn", params, timeout)
+	return sendHTTPRequest(httpClient, url, params, timeout)
 }
 
-func sendUMQAPIHttpRequest(url string, params map[string]string, privateKey string, timeout uint32) (res []byte, err error) {
+func sendUMQAPIHttpRequest(ctx context.Context, httpClient *http.Client, url string, params map[string]string, privateKey string, timeout uint32) (res []byte, err error) {
 	sign := signParams(params, privateKey)
 	params["Signature"] = sign
-	return sendHTTPRequest(url, params, timeout)
+	return sendHTTPRequestContext(ctx, httpClient, url, params, timeout)
 }
 
 func dialHTTPTimeout(timeOut time.Duration) func(net, addr string) (net.Conn, error) {
@@ -82,10 +98,11 @@ func dialHTTPTimeout(timeOut time.Duration) func(net, addr string) (net.Conn, er
 	}
 }
 
-func newTimeoutHTTPClient(timeOut time.Duration) *http.Client {
+func newTimeoutHTTPClient(timeOut time.Duration, tlsConfig *tls.Config) *http.Client {
 	return &http.Client{
 		Transport: &http.Transport{
-			Dial: dialHTTPTimeout(timeOut),
+			Dial:            dialHTTPTimeout(timeOut),
+			TLSClientConfig: tlsConfig,
 		},
 	}
 }
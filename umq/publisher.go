@@ -1,12 +1,99 @@
 package umq
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 )
 
 //PublishMsg 发布消息
 func (publisher *UmqProducer) PublishMsg(queueID, content string) error {
+	return publisher.PublishMsgContext(context.Background(), queueID, content)
+}
+
+// PublishMsgContext 发布消息，ctx中的trace上下文会通过Tracer传递给消费者
+func (publisher *UmqProducer) PublishMsgContext(ctx context.Context, queueID, content string) error {
+	_, err := publisher.PublishMsgResult(ctx, queueID, content)
+	return err
+}
+
+// PublishMsgResult 同PublishMsgContext，返回发送次数等信息
+// 配置了PublishRetry时消息会以封装格式携带幂等键发送
+func (publisher *UmqProducer) PublishMsgResult(ctx context.Context, queueID, content string) (PublishResult, error) {
+	return publisher.publish(ctx, queueID, Envelope{Body: content}, false)
+}
+
+// PublishMessage 以SDK封装格式发布消息，消费者可通过Message.Delivery获取封装的各字段
+func (publisher *UmqProducer) PublishMessage(queueID string, env Envelope) error {
+	return publisher.PublishMessageContext(context.Background(), queueID, env)
+}
+
+// PublishMessageContext 同PublishMessage，ctx中的trace上下文会通过Tracer传递给消费者
+func (publisher *UmqProducer) PublishMessageContext(ctx context.Context, queueID string, env Envelope) error {
+	_, err := publisher.PublishMessageResult(ctx, queueID, env)
+	return err
+}
+
+// PublishMessageResult 同PublishMessageContext，返回发送次数等信息
+// env.IdempotencyKey为空时自动生成，重试时保持不变
+func (publisher *UmqProducer) PublishMessageResult(ctx context.Context, queueID string, env Envelope) (PublishResult, error) {
+	if env.Timestamp.IsZero() {
+		env.Timestamp = time.Now()
+	}
+	return publisher.publish(ctx, queueID, env, true)
+}
+
+// PublishBytes 发布任意二进制数据，payload以base64编码后封装发送
+// 消费者通过SubscribeBytes、Delivery.Bytes或Message.MsgBody获取原始字节
+func (publisher *UmqProducer) PublishBytes(queueID string, payload []byte) error {
+	return publisher.PublishBytesContext(context.Background(), queueID, payload)
+}
+
+// PublishBytesContext 同PublishBytes，ctx中的trace上下文会通过Tracer传递给消费者
+func (publisher *UmqProducer) PublishBytesContext(ctx context.Context, queueID string, payload []byte) error {
+	publisher.client.logger.Debug("umq publish bytes", "queue", queueID,
+		"size", len(payload), "encoded_size", EncodedBytesSize(len(payload)))
+	_, err := publisher.publish(ctx, queueID, Envelope{Body: string(payload), Binary: true}, true)
+	return err
+}
+
+// publish 发布env，wrap为false时只有在需要携带头部或幂等键等时才封装，否则直接发送Body
+// 封装的消息总是带有幂等键，Content只编码一次，重试时发送相同的内容
+func (publisher *UmqProducer) publish(ctx context.Context, queueID string, env Envelope, wrap bool) (PublishResult, error) {
+	start := time.Now()
+	headers := make(map[string]string, len(env.Headers))
+	for k, v := range env.Headers {
+		headers[k] = v
+	}
+	_, end := publisher.client.tracer.StartPublish(ctx, queueID, headers)
+	env.Headers = headers
+	if len(headers) == 0 {
+		env.Headers = nil
+	}
+
+	var result PublishResult
+	content := env.Body
+	var err error
+	client := publisher.client
+	if wrap || len(headers) > 0 || client.compression.shouldCompress(len(env.Body)) ||
+		client.keys != nil || client.signer != nil || client.publishRetry.enabled() {
+		if env.IdempotencyKey == "" {
+			env.IdempotencyKey = newIdempotencyKey()
+		}
+		result.IdempotencyKey = env.IdempotencyKey
+		content, err = client.encodeEnvelope(ctx, queueID, env)
+	}
+	if err == nil {
+		err = publisher.sendWithRetry(ctx, queueID, content, &result)
+	}
+	end(err)
+	publisher.client.metrics.PublishDone(queueID, time.Since(start), err)
+	return result, err
+}
+
+func (publisher *UmqProducer) publishMsg(ctx context.Context, queueID, content string) error {
 	req := map[string]string{
 		"Action":         "PublishMsg",
 		"Region":         publisher.client.region,
@@ -17,14 +104,19 @@ func (publisher *UmqProducer) PublishMsg(queueID, content string) error {
 		"OrganizationId": publisher.client.organizationID,
 	}
 
-	resp, err := sendHTTPRequest(publisher.client.httpAddr, req, 10)
+	resp, err := publisher.client.sendDataRequest(ctx, req)
 	if err != nil {
-		return err
+		// 网络错误时无法确定消息是否已保存，可以重试；消息过大重试也不会成功
+		if errors.Is(err, ErrMessageTooLarge) || ctx.Err() != nil {
+			return err
+		}
+		return &temporaryError{err: err}
 	}
 	var replyBody map[string]interface{}
 	err = json.Unmarshal(resp, &replyBody)
 	if err != nil {
-		return err
+		// 网关等返回的非JSON回包
+		return &temporaryError{err: err}
 	}
 
 	if resultCode, ok := replyBody["RetCode"].(float64); !ok || int(resultCode) != 0 {
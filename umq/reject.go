@@ -0,0 +1,90 @@
+package umq
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RejectAction 被拒绝的消息（签名无效、无法解密或解压）的处理方式
+type RejectAction int
+
+const (
+	// RejectNack 不ack，ack超时后由服务端重新投递，适合密钥尚未下发等可恢复的情况
+	RejectNack RejectAction = iota
+	// RejectDrop ack并丢弃
+	RejectDrop
+	// RejectDeadLetter 交给RejectPolicy.DeadLetter处理，成功后ack，失败时按RejectNack处理
+	RejectDeadLetter
+)
+
+// RejectPolicy 通过UmqConfig.RejectPolicy设置，消费者拒绝消息时使用
+type RejectPolicy struct {
+	Action RejectAction
+	// Action为RejectDeadLetter时必填，msg为收到的原始消息，err为拒绝的原因
+	// 可使用DeadLetterQueue转发到死信队列
+	DeadLetter func(ctx context.Context, queueID string, msg Message, err error) error
+	// 每次拒绝消息时调用，可用于告警，可为空
+	OnReject func(queueID string, msg Message, err error)
+}
+
+// validate 检查RejectPolicy的配置
+func (p RejectPolicy) validate() error {
+	switch p.Action {
+	case RejectNack, RejectDrop:
+	case RejectDeadLetter:
+		if p.DeadLetter == nil {
+			return fmt.Errorf("umq: RejectDeadLetter requires RejectPolicy.DeadLetter")
+		}
+	default:
+		return fmt.Errorf("umq: invalid RejectAction %d", p.Action)
+	}
+	return nil
+}
+
+// 死信消息的头部
+const (
+	// HeaderDeadLetterQueue 消息原来所在的队列
+	HeaderDeadLetterQueue = "umq-dead-letter-queue"
+	// HeaderDeadLetterMsgID 消息原来的MsgId
+	HeaderDeadLetterMsgID = "umq-dead-letter-msg-id"
+	// HeaderDeadLetterReason 拒绝的原因
+	HeaderDeadLetterReason = "umq-dead-letter-reason"
+)
+
+// DeadLetterQueue 返回用于RejectPolicy.DeadLetter的函数，把被拒绝的消息原样发布到queueID
+// 原始内容作为Body，原队列、MsgId及原因写入头部
+func DeadLetterQueue(producer *UmqProducer, queueID string) func(ctx context.Context, sourceQueueID string, msg Message, err error) error {
+	return func(ctx context.Context, sourceQueueID string, msg Message, err error) error {
+		return producer.PublishMessageContext(ctx, queueID, Envelope{
+			Body: msg.MsgBody,
+			Headers: map[string]string{
+				HeaderDeadLetterQueue:  sourceQueueID,
+				HeaderDeadLetterMsgID:  msg.MsgId,
+				HeaderDeadLetterReason: err.Error(),
+			},
+		})
+	}
+}
+
+// reject 按RejectPolicy处理被拒绝的消息，返回是否应ack该消息
+func (client *UmqClient) reject(ctx context.Context, queueID string, msg Message, err error) (ack bool) {
+	policy := client.rejectPolicy
+	client.logger.Error("umq message rejected", "queue", queueID, "msg_id", msg.MsgId, "error", err)
+	if policy.OnReject != nil {
+		policy.OnReject(queueID, msg, err)
+	}
+	switch policy.Action {
+	case RejectDrop:
+		return true
+	case RejectDeadLetter:
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		if dlErr := policy.DeadLetter(ctx, queueID, msg, err); dlErr != nil {
+			client.logger.Error("umq dead letter failed", "queue", queueID, "msg_id", msg.MsgId, "error", dlErr)
+			return false
+		}
+		return true
+	}
+	return false
+}
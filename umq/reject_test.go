@@ -0,0 +1,61 @@
+package umq_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+)
+
+func TestRejectUndecodableEnvelope(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		rejected []error
+	)
+	srv, producer, consumer, queueID := newTestClient(t, func(c *umq.UmqConfig) {
+		c.RejectPolicy = umq.RejectPolicy{
+			Action: umq.RejectDrop,
+			OnReject: func(queueID string, msg umq.Message, err error) {
+				mu.Lock()
+				rejected = append(rejected, err)
+				mu.Unlock()
+			},
+		}
+	})
+	contents := []string{
+		`{"umq":1,"enc":"base64url","b":"!!!"}`,
+		`{"umq":1,"z":"lz4","b":"AAAA"}`,
+		`{"umq":1,"z":"gzip","b":"AAAAAAAA"}`,
+		"plain message",
+	}
+	for _, content := range contents {
+		if err := producer.PublishMsg(queueID, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := consumer.GetMsg(queueID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Msgs) != 1 || info.Msgs[0].MsgBody != "plain message" {
+		t.Fatalf("got %+v, want only the plain message", info.Msgs)
+	}
+	if len(rejected) != 3 {
+		t.Fatalf("rejected %d messages, want 3", len(rejected))
+	}
+	for _, err := range rejected {
+		var envErr *umq.EnvelopeError
+		if !errors.As(err, &envErr) {
+			t.Errorf("reject error %v is not an *EnvelopeError", err)
+		}
+	}
+	if !errors.Is(rejected[1], umq.ErrUnknownCompression) {
+		t.Errorf("reject error %v, want ErrUnknownCompression", rejected[1])
+	}
+	// RejectDrop ack被拒绝的消息
+	consumer.AckMsg(queueID, info.Msgs[0].MsgId)
+	if stats := srv.Stats(queueID); stats.Acked != len(contents) {
+		t.Errorf("stats = %+v, want every message acked", stats)
+	}
+}
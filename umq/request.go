@@ -0,0 +1,138 @@
+package umq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// 数据面请求 (PublishMsg/GetMsg/AckMsg) 使用的HTTP方法，通过UmqConfig.HTTPMethod设置
+const (
+	// HTTPMethodAuto 默认使用GET，URL超过MaxURLLength时改用POST，服务端不支持POST时返回ErrMessageTooLarge
+	HTTPMethodAuto = ""
+	// HTTPMethodGet 总是把参数放在查询串中
+	HTTPMethodGet = http.MethodGet
+	// HTTPMethodPost 总是以JSON请求体发送参数
+	HTTPMethodPost = http.MethodPost
+)
+
+// DefaultMaxURLLength 默认的GET请求URL最大长度（字节），常见的网关及服务端上限为8KB
+const DefaultMaxURLLength = 8000
+
+// ErrMessageTooLarge 消息超过了服务端能接受的大小，具体的大小及上限见MessageTooLargeError
+var ErrMessageTooLarge = errors.New("umq: message too large")
+
+// MessageTooLargeError 请求因消息过大无法发送，errors.Is(err, ErrMessageTooLarge)为true
+type MessageTooLargeError struct {
+	// 发送失败的HTTP方法
+	Method string
+	// GET时为URL长度，POST时为请求体长度
+	Size int
+	// 对应的上限，0表示上限未知（由服务端拒绝，且未配置MaxBodySize）
+	Limit int
+}
+
+func (e *MessageTooLargeError) Error() string {
+	if e.Limit == 0 {
+		return fmt.Sprintf("umq: message too large: %s request of %d bytes rejected by server", e.Method, e.Size)
+	}
+	return fmt.Sprintf("umq: message too large: %s request of %d bytes exceeds limit of %d bytes", e.Method, e.Size, e.Limit)
+}
+
+func (e *MessageTooLargeError) Is(target error) bool {
+	return target == ErrMessageTooLarge
+}
+
+// validHTTPMethod 检查UmqConfig.HTTPMethod
+func validHTTPMethod(method string) error {
+	switch method {
+	case HTTPMethodAuto, HTTPMethodGet, HTTPMethodPost:
+		return nil
+	}
+	return fmt.Errorf("umq: invalid HTTPMethod %q", method)
+}
+
+// postUnsupported 服务端不支持POST时返回的状态码
+func postUnsupported(status int) bool {
+	return status == http.StatusNotFound || status == http.StatusMethodNotAllowed ||
+		status == http.StatusNotImplemented
+}
+
+// dataRequest 数据面请求的发送方式，由UmqClient持有
+type dataRequest struct {
+	method       string
+	maxURLLength int
+	maxBodySize  int
+	// HTTPMethodAuto下服务端拒绝过POST，之后超长的请求直接返回ErrMessageTooLarge
+	noPost atomic.Bool
+}
+
+// sendDataRequest 发送数据面请求，按配置选择GET或POST
+func (client *UmqClient) sendDataRequest(ctx context.Context, params map[string]string) ([]byte, error) {
+	client.logRequest(params)
+	req := &client.request
+	if req.method == HTTPMethodPost {
+		return client.post(ctx, params)
+	}
+
+	url := buildQueryURL(client.httpAddr, params)
+	tooLong := &MessageTooLargeError{Method: http.MethodGet, Size: len(url), Limit: req.maxURLLength}
+	if len(url) <= req.maxURLLength {
+		status, res, err := getHTTPRequestContext(ctx, client.httpClient, url)
+		if err != nil || status != http.StatusRequestURITooLong {
+			return res, err
+		}
+		// 服务端的上限比MaxURLLength小，未知具体值
+		tooLong.Limit = 0
+	}
+	if req.method == HTTPMethodGet || req.noPost.Load() {
+		return nil, tooLong
+	}
+
+	client.logger.Debug("umq url too long, falling back to POST", "action", params["Action"],
+		"url_length", len(url), "max_url_length", req.maxURLLength)
+	res, err := client.post(ctx, params)
+	var unsupported *postUnsupportedError
+	if errors.As(err, &unsupported) {
+		req.noPost.Store(true)
+		client.logger.Warn("umq server does not support POST, large messages will be rejected",
+			"status", unsupported.status, "max_url_length", req.maxURLLength)
+		return nil, tooLong
+	}
+	return res, err
+}
+
+// postUnsupportedError 服务端不接受POST请求
+type postUnsupportedError struct {
+	status int
+}
+
+func (e *postUnsupportedError) Error() string {
+	return fmt.Sprintf("umq: server does not support POST requests (HTTP %d)", e.status)
+}
+
+// post 以POST发送params
+func (client *UmqClient) post(ctx context.Context, params map[string]string) ([]byte, error) {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	size, maxBodySize := len(body), client.request.maxBodySize
+	if maxBodySize > 0 && size > maxBodySize {
+		return nil, &MessageTooLargeError{Method: http.MethodPost, Size: size, Limit: maxBodySize}
+	}
+	status, res, err := postHTTPRequestContext(ctx, client.httpClient, client.httpAddr, body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case status == http.StatusRequestEntityTooLarge:
+		return nil, &MessageTooLargeError{Method: http.MethodPost, Size: size, Limit: maxBodySize}
+	case postUnsupported(status):
+		return nil, &postUnsupportedError{status: status}
+	}
+	return res, nil
+}
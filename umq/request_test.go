@@ -0,0 +1,182 @@
+package umq_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+	"github.com/ucloud/umq-sdk-go/umq/umqtest"
+)
+
+// methodRecorder 记录每个请求的方法及响应状态码
+type methodRecorder struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (r *methodRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err == nil {
+		r.mu.Lock()
+		r.requests = append(r.requests, fmt.Sprintf("%s %d", req.Method, res.StatusCode))
+		r.mu.Unlock()
+	}
+	return res, err
+}
+
+// take 返回并清空已记录的请求
+func (r *methodRecorder) take() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	requests := r.requests
+	r.requests = nil
+	return requests
+}
+
+// newRequestClient 返回记录请求方法的client，srvMod可修改服务端的行为
+func newRequestClient(t *testing.T, srvMod func(*umqtest.Server), mod func(*umq.UmqConfig)) (*methodRecorder, *umq.UmqProducer, *umq.UmqConsumer, string) {
+	rec := &methodRecorder{}
+	srv, producer, consumer, queueID := newTestClient(t, func(c *umq.UmqConfig) {
+		c.HTTPTransport = rec
+		mod(c)
+	})
+	if srvMod != nil {
+		srvMod(srv)
+	}
+	rec.take()
+	return rec, producer, consumer, queueID
+}
+
+// checkTooLarge 检查err为指定方法及上限的*MessageTooLargeError
+func checkTooLarge(t *testing.T, err error, method string, limit int) {
+	t.Helper()
+	var tooLarge *umq.MessageTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("err = %v, want *MessageTooLargeError", err)
+	}
+	if !errors.Is(err, umq.ErrMessageTooLarge) {
+		t.Error("errors.Is(err, ErrMessageTooLarge) is false")
+	}
+	if tooLarge.Method != method || tooLarge.Limit != limit || tooLarge.Size <= limit {
+		t.Errorf("MessageTooLargeError = %+v, want Method %s and Limit %d below Size", tooLarge, method, limit)
+	}
+}
+
+func checkRequests(t *testing.T, rec *methodRecorder, want ...string) {
+	t.Helper()
+	if got := rec.take(); !reflect.DeepEqual(got, want) && !(len(got) == 0 && len(want) == 0) {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+}
+
+// checkReceived 检查队列中的消息内容依次为bodies
+func checkReceived(t *testing.T, consumer *umq.UmqConsumer, queueID string, bodies ...string) {
+	t.Helper()
+	info, err := consumer.GetMsg(queueID, len(bodies)+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Msgs) != len(bodies) {
+		t.Fatalf("got %d messages, want %d", len(info.Msgs), len(bodies))
+	}
+	for i, msg := range info.Msgs {
+		if msg.MsgBody != bodies[i] {
+			t.Errorf("message %d has %d bytes, want %d", i, len(msg.MsgBody), len(bodies[i]))
+		}
+	}
+}
+
+var (
+	smallBody = "small"
+	largeBody = strings.Repeat("x", 1000)
+)
+
+func TestAutoSwitchesToPost(t *testing.T) {
+	rec, producer, consumer, queueID := newRequestClient(t, nil, func(c *umq.UmqConfig) {
+		c.MaxURLLength = 500
+	})
+	for _, body := range []string{smallBody, largeBody} {
+		if err := producer.PublishMsg(queueID, body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 超长的请求不先尝试GET
+	checkRequests(t, rec, "GET 200", "POST 200")
+	checkReceived(t, consumer, queueID, smallBody, largeBody)
+}
+
+func TestURITooLongFallsBackToPost(t *testing.T) {
+	rec, producer, consumer, queueID := newRequestClient(t, func(srv *umqtest.Server) {
+		srv.SetMaxURLLength(500)
+	}, func(*umq.UmqConfig) {})
+	if err := producer.PublishMsg(queueID, largeBody); err != nil {
+		t.Fatal(err)
+	}
+	checkRequests(t, rec, "GET 414", "POST 200")
+	checkReceived(t, consumer, queueID, largeBody)
+}
+
+func TestPostUnsupported(t *testing.T) {
+	t.Run("URITooLong", func(t *testing.T) {
+		rec, producer, _, queueID := newRequestClient(t, func(srv *umqtest.Server) {
+			srv.SetMaxURLLength(500)
+			srv.DisablePost(true)
+		}, func(*umq.UmqConfig) {})
+		// 服务端的上限未知，Limit为0
+		checkTooLarge(t, producer.PublishMsg(queueID, largeBody), http.MethodGet, 0)
+		checkRequests(t, rec, "GET 414", "POST 405")
+		// 之后不再尝试POST
+		checkTooLarge(t, producer.PublishMsg(queueID, largeBody), http.MethodGet, 0)
+		checkRequests(t, rec, "GET 414")
+	})
+	t.Run("MaxURLLength", func(t *testing.T) {
+		rec, producer, consumer, queueID := newRequestClient(t, func(srv *umqtest.Server) {
+			srv.DisablePost(true)
+		}, func(c *umq.UmqConfig) {
+			c.MaxURLLength = 500
+		})
+		checkTooLarge(t, producer.PublishMsg(queueID, largeBody), http.MethodGet, 500)
+		checkRequests(t, rec, "POST 405")
+		checkTooLarge(t, producer.PublishMsg(queueID, largeBody), http.MethodGet, 500)
+		checkRequests(t, rec)
+		// 较小的消息仍以GET发送
+		if err := producer.PublishMsg(queueID, smallBody); err != nil {
+			t.Fatal(err)
+		}
+		checkRequests(t, rec, "GET 200")
+		checkReceived(t, consumer, queueID, smallBody)
+	})
+}
+
+func TestMaxBodySize(t *testing.T) {
+	rec, producer, consumer, queueID := newRequestClient(t, nil, func(c *umq.UmqConfig) {
+		c.HTTPMethod = umq.HTTPMethodPost
+		c.MaxBodySize = 500
+	})
+	checkTooLarge(t, producer.PublishMsg(queueID, largeBody), http.MethodPost, 500)
+	checkRequests(t, rec)
+	if err := producer.PublishMsg(queueID, smallBody); err != nil {
+		t.Fatal(err)
+	}
+	checkRequests(t, rec, "POST 200")
+	checkReceived(t, consumer, queueID, smallBody)
+}
+
+func TestForcedGet(t *testing.T) {
+	rec, producer, consumer, queueID := newRequestClient(t, nil, func(c *umq.UmqConfig) {
+		c.HTTPMethod = umq.HTTPMethodGet
+		c.MaxURLLength = 500
+	})
+	checkTooLarge(t, producer.PublishMsg(queueID, largeBody), http.MethodGet, 500)
+	checkRequests(t, rec)
+	if err := producer.PublishMsg(queueID, smallBody); err != nil {
+		t.Fatal(err)
+	}
+	checkRequests(t, rec, "GET 200")
+	checkReceived(t, consumer, queueID, smallBody)
+}
@@ -0,0 +1,121 @@
+package umq
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	mathrand "math/rand"
+	"time"
+)
+
+// 默认的发布重试间隔
+const (
+	DefaultRetryBackoff    = 100 * time.Millisecond
+	DefaultRetryMaxBackoff = 2 * time.Second
+)
+
+// RetryPolicy 发布失败时的重试策略，通过UmqConfig.PublishRetry设置
+// 只重试网络错误、超时等无法确定服务端是否已保存消息的失败，服务端明确拒绝的请求不重试。
+// 重试的消息携带相同的IdempotencyKey，消费者可用umqdedup去掉重复
+type RetryPolicy struct {
+	// 最多发送的次数，包括第一次，<=1时不重试
+	MaxAttempts int
+	// 第一次重试前的等待时间，之后每次翻倍，0表示DefaultRetryBackoff
+	Backoff time.Duration
+	// 最长的等待时间，0表示DefaultRetryMaxBackoff
+	MaxBackoff time.Duration
+	// 每次发送的超时时间，0表示只受ctx限制
+	AttemptTimeout time.Duration
+}
+
+func (p RetryPolicy) enabled() bool {
+	return p.MaxAttempts > 1
+}
+
+// backoff 返回第attempt次发送失败后的等待时间，加入最多50%的随机抖动
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d, max := p.Backoff, p.MaxBackoff
+	if d <= 0 {
+		d = DefaultRetryBackoff
+	}
+	if max <= 0 {
+		max = DefaultRetryMaxBackoff
+	}
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d/2 + time.Duration(mathrand.Int63n(int64(d/2)+1))
+}
+
+// PublishResult 一次发布的结果
+type PublishResult struct {
+	// 消息的幂等键，消息未封装时为空
+	IdempotencyKey string
+	// 发送的次数，包括第一次
+	Attempts int
+	// 是否发生过重试，为true时服务端可能保存了多份，消费者需按IdempotencyKey去重
+	Retried bool
+}
+
+// temporaryError 可以重试的发布失败，服务端可能已保存消息
+type temporaryError struct {
+	err error
+}
+
+func (e *temporaryError) Error() string { return e.err.Error() }
+func (e *temporaryError) Unwrap() error { return e.err }
+
+// isTemporary 判断发送失败是否可以重试，ctx的取消及超时由调用方判断
+func isTemporary(err error) bool {
+	var tmp *temporaryError
+	return errors.As(err, &tmp)
+}
+
+// newIdempotencyKey 生成随机的幂等键
+func newIdempotencyKey() string {
+	var buf [16]byte
+	rand.Read(buf[:])
+	return base64Encoding.EncodeToString(buf[:])
+}
+
+// sendWithRetry 按client.publishRetry发送content，content在各次发送之间保持不变
+func (publisher *UmqProducer) sendWithRetry(ctx context.Context, queueID, content string, result *PublishResult) error {
+	client := publisher.client
+	policy := client.publishRetry
+	for {
+		result.Attempts++
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if policy.AttemptTimeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, policy.AttemptTimeout)
+		}
+		err := publisher.publishMsg(attemptCtx, queueID, content)
+		timedOut := attemptCtx.Err() != nil
+		cancel()
+		if err == nil {
+			return nil
+		}
+		// 单次发送超时可以重试，调用方的ctx结束则不再重试
+		temporary := isTemporary(err) || timedOut
+		var tmp *temporaryError
+		if errors.As(err, &tmp) {
+			err = tmp.err
+		}
+		if !temporary || result.Attempts >= policy.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+		backoff := policy.backoff(result.Attempts)
+		client.logger.Warn("umq publish failed, retrying", "queue", queueID,
+			"attempt", result.Attempts, "backoff", backoff, "error", err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		result.Retried = true
+	}
+}
@@ -0,0 +1,149 @@
+package umq_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+	"github.com/ucloud/umq-sdk-go/umq/umqfault"
+)
+
+// newRetryProducer 返回经过故障注入的生产者，rec记录每次发送的Content
+func newRetryProducer(t *testing.T, q *testQueue, policy umq.RetryPolicy, mod func(*umq.UmqConfig)) (*umqfault.Injector, *contentRecorder, *umq.UmqProducer) {
+	in := umqfault.New(1)
+	rec := &contentRecorder{}
+	producer := q.producer(t, func(c *umq.UmqConfig) {
+		c.HTTPTransport = in.RoundTripper(rec)
+		c.PublishRetry = policy
+		if mod != nil {
+			mod(c)
+		}
+	})
+	return in, rec, producer
+}
+
+func TestRetryDroppedResponse(t *testing.T) {
+	q := newTestQueue(t)
+	in, rec, producer := newRetryProducer(t, q, umq.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}, nil)
+	// 服务端已保存消息但客户端没有收到响应
+	in.Add(umqfault.Rule{Action: "PublishMsg", DropResponse: true, Times: 2})
+
+	res, err := producer.PublishMsgResult(context.Background(), q.queueID, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Attempts != 3 || !res.Retried || res.IdempotencyKey == "" {
+		t.Fatalf("result = %+v, want 3 attempts with an idempotency key", res)
+	}
+	rec.mu.Lock()
+	contents := rec.contents
+	rec.mu.Unlock()
+	if len(contents) != 3 || contents[1] != contents[0] || contents[2] != contents[0] {
+		t.Errorf("attempts sent different contents: %q", contents)
+	}
+
+	// 三次发送服务端都已保存，幂等键相同供消费者去重
+	info, err := q.consumer(t, nil).GetMsg(q.queueID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Msgs) != 3 {
+		t.Fatalf("server stored %d messages, want 3", len(info.Msgs))
+	}
+	for _, msg := range info.Msgs {
+		if d := msg.Delivery(); d.Body != "hello" || d.IdempotencyKey != res.IdempotencyKey {
+			t.Errorf("stored %+v, want idempotency key %q", d, res.IdempotencyKey)
+		}
+	}
+
+	// 用完MaxAttempts后返回最后一次的错误
+	in.Add(umqfault.Rule{Action: "PublishMsg", Drop: true})
+	res, err = producer.PublishMsgResult(context.Background(), q.queueID, "hello")
+	if !errors.Is(err, umqfault.ErrInjected) || res.Attempts != 3 {
+		t.Errorf("PublishMsgResult = %+v, %v, want ErrInjected after 3 attempts", res, err)
+	}
+}
+
+func TestRetryPermanentErrors(t *testing.T) {
+	q := newTestQueue(t)
+	policy := umq.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+	t.Run("RetCode", func(t *testing.T) {
+		in, _, producer := newRetryProducer(t, q, policy, nil)
+		in.Add(umqfault.Rule{Action: "PublishMsg", RetCode: 5000, Message: "rejected"})
+		res, err := producer.PublishMsgResult(context.Background(), q.queueID, "hello")
+		if err == nil || !strings.Contains(err.Error(), "rejected") || res.Attempts != 1 || res.Retried {
+			t.Errorf("PublishMsgResult = %+v, %v, want the RetCode error without retry", res, err)
+		}
+	})
+	t.Run("MessageTooLarge", func(t *testing.T) {
+		_, rec, producer := newRetryProducer(t, q, policy, func(c *umq.UmqConfig) {
+			c.HTTPMethod = umq.HTTPMethodGet
+			c.MaxURLLength = 500
+		})
+		res, err := producer.PublishMsgResult(context.Background(), q.queueID, strings.Repeat("x", 1000))
+		if !errors.Is(err, umq.ErrMessageTooLarge) || res.Attempts != 1 || res.Retried {
+			t.Errorf("PublishMsgResult = %+v, %v, want ErrMessageTooLarge without retry", res, err)
+		}
+		if len(rec.contents) != 0 {
+			t.Errorf("sent %d requests", len(rec.contents))
+		}
+	})
+}
+
+func TestRetryStopsWhenContextDone(t *testing.T) {
+	q := newTestQueue(t)
+
+	t.Run("DuringBackoff", func(t *testing.T) {
+		in, _, producer := newRetryProducer(t, q, umq.RetryPolicy{MaxAttempts: 5, Backoff: 10 * time.Second}, nil)
+		in.Add(umqfault.Rule{Action: "PublishMsg", Drop: true})
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		start := time.Now()
+		res, err := producer.PublishMsgResult(ctx, q.queueID, "hello")
+		if !errors.Is(err, umqfault.ErrInjected) || res.Attempts != 1 {
+			t.Errorf("PublishMsgResult = %+v, %v, want the first error", res, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("returned after %v, want it to stop waiting on cancel", elapsed)
+		}
+	})
+	t.Run("DuringAttempt", func(t *testing.T) {
+		in, _, producer := newRetryProducer(t, q, umq.RetryPolicy{MaxAttempts: 5, Backoff: time.Millisecond}, nil)
+		in.Add(umqfault.Rule{Action: "PublishMsg", Delay: 10 * time.Second})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		res, err := producer.PublishMsgResult(ctx, q.queueID, "hello")
+		if !errors.Is(err, context.DeadlineExceeded) || res.Attempts != 1 {
+			t.Errorf("PublishMsgResult = %+v, %v, want DeadlineExceeded after one attempt", res, err)
+		}
+	})
+}
+
+func TestRetryAttemptTimeout(t *testing.T) {
+	q := newTestQueue(t)
+	in, _, producer := newRetryProducer(t, q, umq.RetryPolicy{
+		MaxAttempts:    3,
+		Backoff:        time.Millisecond,
+		AttemptTimeout: 50 * time.Millisecond,
+	}, nil)
+	// 第一次发送超过AttemptTimeout，在发出请求前被取消
+	in.Add(umqfault.Rule{Action: "PublishMsg", Delay: 10 * time.Second, Times: 1})
+	start := time.Now()
+	res, err := producer.PublishMsgResult(context.Background(), q.queueID, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Attempts != 2 || !res.Retried {
+		t.Errorf("result = %+v, want success on the second attempt", res)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %v, the first attempt was not cut off", elapsed)
+	}
+	if stats := q.srv.Stats(q.queueID); stats.Published != 1 {
+		t.Errorf("stats = %+v, want 1 published", stats)
+	}
+}
@@ -0,0 +1,185 @@
+package umq
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// 签名算法
+const (
+	SignatureHMACSHA256 = "hs256"
+	SignatureEd25519    = "ed25519"
+)
+
+// Signer 为发布的消息签名，签名覆盖消息体、头部及封装的其他字段，并绑定队列ID
+type Signer interface {
+	// Sign 返回签名算法、密钥ID及data的签名
+	Sign(ctx context.Context, data []byte) (algorithm, keyID string, sig []byte, err error)
+}
+
+// Verifier 验证消息的签名
+type Verifier interface {
+	// Verify 验证data的签名，签名无效或没有对应的密钥时返回错误
+	Verify(ctx context.Context, algorithm, keyID string, data, sig []byte) error
+}
+
+var (
+	// ErrMissingSignature 配置了Verifier但消息没有签名，包括非SDK封装的普通字符串消息
+	ErrMissingSignature = errors.New("umq: message is not signed")
+	// ErrInvalidSignature 签名与消息内容不符
+	ErrInvalidSignature = errors.New("umq: invalid message signature")
+)
+
+// SignatureError 消息签名验证失败
+type SignatureError struct {
+	Algorithm string
+	KeyID     string
+	Err       error
+}
+
+func (e *SignatureError) Error() string {
+	if e.Err == ErrMissingSignature {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("umq: verify %s signature with key %q: %v", e.Algorithm, e.KeyID, e.Err)
+}
+
+func (e *SignatureError) Unwrap() error {
+	return e.Err
+}
+
+type hmacSigner struct {
+	keyID string
+	key   []byte
+}
+
+// NewHMACSigner 使用HMAC-SHA256签名，消费者须在KeySet.HMAC中配置相同的密钥
+func NewHMACSigner(keyID string, key []byte) Signer {
+	return &hmacSigner{keyID: keyID, key: append([]byte(nil), key...)}
+}
+
+func (s *hmacSigner) Sign(ctx context.Context, data []byte) (string, string, []byte, error) {
+	return SignatureHMACSHA256, s.keyID, hmacSHA256(s.key, data), nil
+}
+
+type ed25519Signer struct {
+	keyID string
+	key   ed25519.PrivateKey
+}
+
+// NewEd25519Signer 使用Ed25519签名，消费者只需在KeySet.Ed25519中配置公钥
+// key的长度须为ed25519.PrivateKeySize，否则返回错误
+func NewEd25519Signer(keyID string, key ed25519.PrivateKey) (Signer, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("umq: ed25519 private key %q is %d bytes, want %d", keyID, len(key), ed25519.PrivateKeySize)
+	}
+	return &ed25519Signer{keyID: keyID, key: append(ed25519.PrivateKey(nil), key...)}, nil
+}
+
+func (s *ed25519Signer) Sign(ctx context.Context, data []byte) (string, string, []byte, error) {
+	return SignatureEd25519, s.keyID, ed25519.Sign(s.key, data), nil
+}
+
+// KeySet 按密钥ID验证签名的Verifier，同时配置多个密钥即可在轮换期间接受新旧签名
+type KeySet struct {
+	// HMAC-SHA256的共享密钥
+	HMAC map[string][]byte
+	// Ed25519的公钥
+	Ed25519 map[string]ed25519.PublicKey
+}
+
+func (k KeySet) Verify(ctx context.Context, algorithm, keyID string, data, sig []byte) error {
+	switch algorithm {
+	case SignatureHMACSHA256:
+		key, ok := k.HMAC[keyID]
+		if !ok {
+			return ErrUnknownKey
+		}
+		if !hmac.Equal(sig, hmacSHA256(key, data)) {
+			return ErrInvalidSignature
+		}
+	case SignatureEd25519:
+		key, ok := k.Ed25519[keyID]
+		if !ok {
+			return ErrUnknownKey
+		}
+		if len(key) != ed25519.PublicKeySize || !ed25519.Verify(key, data, sig) {
+			return ErrInvalidSignature
+		}
+	default:
+		return fmt.Errorf("umq: unknown signature algorithm %q", algorithm)
+	}
+	return nil
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// signingInput 签名覆盖的内容: 队列ID及封装中除签名相关字段外的全部字段，各字段带长度前缀以免拼接产生歧义
+// Body为发送时的形式，即压缩、加密之后的内容。签名算法及密钥ID不在其中，
+// KeySet按算法分别保存密钥，篡改二者只会导致验证失败
+func signingInput(queueID string, wire *envelope) []byte {
+	buf := []byte("umq-sig/1")
+	field := func(s string) {
+		buf = binary.AppendUvarint(buf, uint64(len(s)))
+		buf = append(buf, s...)
+	}
+	field(queueID)
+	field(strconv.Itoa(wire.Version))
+	field(wire.ContentType)
+	field(wire.CorrelationID)
+	field(wire.RoutingKey)
+	field(wire.IdempotencyKey)
+	field(strconv.FormatInt(wire.Timestamp, 10))
+	field(wire.Encoding)
+	field(wire.Compression)
+	field(wire.KeyID)
+	keys := make([]string, 0, len(wire.Headers))
+	for k := range wire.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf = binary.AppendUvarint(buf, uint64(len(keys)))
+	for _, k := range keys {
+		field(k)
+		field(wire.Headers[k])
+	}
+	field(wire.Body)
+	return buf
+}
+
+// sign 为wire签名
+func (client *UmqClient) sign(ctx context.Context, queueID string, wire *envelope) error {
+	alg, keyID, sig, err := client.signer.Sign(ctx, signingInput(queueID, wire))
+	if err != nil {
+		return err
+	}
+	wire.SigAlgorithm, wire.SigKeyID = alg, keyID
+	wire.Signature = base64Encoding.EncodeToString(sig)
+	return nil
+}
+
+// verify 验证wire的签名，wire为nil表示消息不是SDK封装格式
+func (client *UmqClient) verify(ctx context.Context, queueID string, wire *envelope) error {
+	if wire == nil || wire.Signature == "" {
+		return &SignatureError{Err: ErrMissingSignature}
+	}
+	sig, err := base64Encoding.DecodeString(wire.Signature)
+	if err != nil {
+		return &SignatureError{Algorithm: wire.SigAlgorithm, KeyID: wire.SigKeyID, Err: ErrInvalidSignature}
+	}
+	if err := client.verifier.Verify(ctx, wire.SigAlgorithm, wire.SigKeyID, signingInput(queueID, wire), sig); err != nil {
+		return &SignatureError{Algorithm: wire.SigAlgorithm, KeyID: wire.SigKeyID, Err: err}
+	}
+	return nil
+}
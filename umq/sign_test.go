@@ -0,0 +1,247 @@
+package umq_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+)
+
+var hmacKey = []byte("0123456789abcdef0123456789abcdef")
+
+// checkSignatureErrors 检查每个拒绝原因都是*SignatureError且包装了want
+func checkSignatureErrors(t *testing.T, errs []error, want ...error) {
+	t.Helper()
+	if len(errs) != len(want) {
+		t.Fatalf("rejected %d messages (%v), want %d", len(errs), errs, len(want))
+	}
+	for i, err := range errs {
+		var sigErr *umq.SignatureError
+		if !errors.As(err, &sigErr) || !errors.Is(err, want[i]) {
+			t.Errorf("reject %d: %v, want *SignatureError wrapping %v", i, err, want[i])
+		}
+	}
+}
+
+func TestSignatureTampering(t *testing.T) {
+	q := newTestQueue(t)
+	rec := &contentRecorder{}
+	producer := q.producer(t, func(c *umq.UmqConfig) {
+		c.Signer = umq.NewHMACSigner("s1", hmacKey)
+		c.HTTPTransport = rec
+	})
+	err := producer.PublishMessage(q.queueID, umq.Envelope{
+		Body:           "hello",
+		Headers:        map[string]string{"tenant": "a"},
+		IdempotencyKey: "ik-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := rec.last()
+	replacements := [][2]string{
+		{`"b":"hello"`, `"b":"HELLO"`},
+		{`"tenant":"a"`, `"tenant":"b"`},
+		{`"ik":"ik-1"`, `"ik":"ik-2"`},
+	}
+	raw := q.producer(t, nil)
+	for _, r := range replacements {
+		if !strings.Contains(content, r[0]) {
+			t.Fatalf("Content %s has no %s", content, r[0])
+		}
+		if err := raw.PublishMsg(q.queueID, strings.Replace(content, r[0], r[1], 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	verify := func(c *umq.UmqConfig, rejects *rejectRecorder) {
+		c.Verifier = umq.KeySet{HMAC: map[string][]byte{"s1": hmacKey}}
+		c.RejectPolicy = umq.RejectPolicy{Action: umq.RejectDrop, OnReject: rejects.onReject}
+	}
+	rejects := &rejectRecorder{}
+	consumer := q.consumer(t, func(c *umq.UmqConfig) { verify(c, rejects) })
+	info, err := consumer.GetMsg(q.queueID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Msgs) != 1 || info.Msgs[0].MsgBody != "hello" || info.Msgs[0].Delivery().SignatureKeyID != "s1" {
+		t.Fatalf("got %+v, want only the original message", info.Msgs)
+	}
+	checkSignatureErrors(t, rejects.take(), umq.ErrInvalidSignature, umq.ErrInvalidSignature, umq.ErrInvalidSignature)
+
+	// 签名绑定队列ID，原样转发到其他队列的消息无法通过验证
+	otherID := q.srv.CreateQueue("other", "Direct")
+	pubID, pubToken := q.srv.CreateRole(otherID, "Pub")
+	subID, subToken := q.srv.CreateRole(otherID, "Sub")
+	if err := q.client(t, nil).NewProducer(pubID, pubToken).PublishMsg(otherID, content); err != nil {
+		t.Fatal(err)
+	}
+	other := q.client(t, func(c *umq.UmqConfig) { verify(c, rejects) }).NewConsumer(subID, subToken)
+	if info, err = other.GetMsg(otherID, 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Msgs) != 0 {
+		t.Fatalf("message replayed to another queue was delivered: %+v", info.Msgs)
+	}
+	checkSignatureErrors(t, rejects.take(), umq.ErrInvalidSignature)
+}
+
+func TestSignatureMissingOrUnknownKey(t *testing.T) {
+	q := newTestQueue(t)
+	if err := q.producer(t, nil).PublishMsg(q.queueID, "plain"); err != nil {
+		t.Fatal(err)
+	}
+	unknown := q.producer(t, func(c *umq.UmqConfig) { c.Signer = umq.NewHMACSigner("s9", hmacKey) })
+	if err := unknown.PublishMsg(q.queueID, "signed with s9"); err != nil {
+		t.Fatal(err)
+	}
+
+	rejects := &rejectRecorder{}
+	consumer := q.consumer(t, func(c *umq.UmqConfig) {
+		c.Verifier = umq.KeySet{HMAC: map[string][]byte{"s1": hmacKey}}
+		c.RejectPolicy = umq.RejectPolicy{Action: umq.RejectDrop, OnReject: rejects.onReject}
+	})
+	info, err := consumer.GetMsg(q.queueID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Msgs) != 0 {
+		t.Fatalf("unverified messages delivered: %+v", info.Msgs)
+	}
+	checkSignatureErrors(t, rejects.take(), umq.ErrMissingSignature, umq.ErrUnknownKey)
+}
+
+func TestSignatureKeyRotation(t *testing.T) {
+	q := newTestQueue(t)
+	keySet := umq.KeySet{
+		HMAC:    map[string][]byte{"h1": hmacKey},
+		Ed25519: map[string]ed25519.PublicKey{},
+	}
+	signers := map[string]umq.Signer{"h1": umq.NewHMACSigner("h1", hmacKey)}
+	for _, id := range []string{"e1", "e2"} {
+		pub, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keySet.Ed25519[id] = pub
+		if signers[id], err = umq.NewEd25519Signer(id, priv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"h1", "e1", "e2"} {
+		producer := q.producer(t, func(c *umq.UmqConfig) { c.Signer = signers[id] })
+		if err := producer.PublishMsg(q.queueID, "from "+id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	consumer := q.consumer(t, func(c *umq.UmqConfig) { c.Verifier = keySet })
+	info, err := consumer.GetMsg(q.queueID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Msgs) != 3 {
+		t.Fatalf("got %d messages, want 3", len(info.Msgs))
+	}
+	for _, msg := range info.Msgs {
+		if d := msg.Delivery(); d.Body != "from "+d.SignatureKeyID {
+			t.Errorf("message %q verified with key %q", d.Body, d.SignatureKeyID)
+		}
+	}
+}
+
+func TestRejectPolicy(t *testing.T) {
+	verifier := umq.KeySet{HMAC: map[string][]byte{"s1": hmacKey}}
+	// reject 发布一条未签名的消息，由按policy配置的消费者拒绝，返回队列的ack数
+	reject := func(t *testing.T, q *testQueue, policy umq.RejectPolicy) (acked int) {
+		if err := q.producer(t, nil).PublishMsg(q.queueID, "unsigned"); err != nil {
+			t.Fatal(err)
+		}
+		consumer := q.consumer(t, func(c *umq.UmqConfig) {
+			c.Verifier = verifier
+			c.RejectPolicy = policy
+		})
+		info, err := consumer.GetMsg(q.queueID, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(info.Msgs) != 0 {
+			t.Fatalf("unsigned message delivered: %+v", info.Msgs)
+		}
+		return q.srv.Stats(q.queueID).Acked
+	}
+
+	t.Run("Nack", func(t *testing.T) {
+		q := newTestQueue(t)
+		rejects := &rejectRecorder{}
+		if acked := reject(t, q, umq.RejectPolicy{OnReject: rejects.onReject}); acked != 0 {
+			t.Errorf("acked %d messages, want 0", acked)
+		}
+		checkSignatureErrors(t, rejects.take(), umq.ErrMissingSignature)
+	})
+	t.Run("Drop", func(t *testing.T) {
+		if acked := reject(t, newTestQueue(t), umq.RejectPolicy{Action: umq.RejectDrop}); acked != 1 {
+			t.Errorf("acked %d messages, want 1", acked)
+		}
+	})
+	t.Run("DeadLetter", func(t *testing.T) {
+		q := newTestQueue(t)
+		dlqID := q.srv.CreateQueue("dlq", "Direct")
+		pubID, pubToken := q.srv.CreateRole(dlqID, "Pub")
+		subID, subToken := q.srv.CreateRole(dlqID, "Sub")
+		dlqProducer := q.client(t, nil).NewProducer(pubID, pubToken)
+		policy := umq.RejectPolicy{Action: umq.RejectDeadLetter, DeadLetter: umq.DeadLetterQueue(dlqProducer, dlqID)}
+		if acked := reject(t, q, policy); acked != 1 {
+			t.Errorf("acked %d messages, want the dead-lettered message acked", acked)
+		}
+
+		info, err := q.client(t, nil).NewConsumer(subID, subToken).GetMsg(dlqID, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(info.Msgs) != 1 {
+			t.Fatalf("dead letter queue has %d messages, want 1", len(info.Msgs))
+		}
+		d := info.Msgs[0].Delivery()
+		if d.Body != "unsigned" || d.Headers[umq.HeaderDeadLetterQueue] != q.queueID ||
+			!strings.HasPrefix(d.Headers[umq.HeaderDeadLetterMsgID], "msg-") ||
+			d.Headers[umq.HeaderDeadLetterReason] != umq.ErrMissingSignature.Error() {
+			t.Errorf("dead letter = %+v", d)
+		}
+	})
+	t.Run("DeadLetterFails", func(t *testing.T) {
+		policy := umq.RejectPolicy{
+			Action: umq.RejectDeadLetter,
+			DeadLetter: func(ctx context.Context, queueID string, msg umq.Message, err error) error {
+				return errors.New("dead letter queue unavailable")
+			},
+		}
+		// 转发失败时按RejectNack处理
+		if acked := reject(t, newTestQueue(t), policy); acked != 0 {
+			t.Errorf("acked %d messages, want 0", acked)
+		}
+	})
+}
+
+func TestNewEd25519SignerKeyLength(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []ed25519.PrivateKey{nil, priv[:ed25519.SeedSize], append(priv, 0)} {
+		if s, err := umq.NewEd25519Signer("e1", key); err == nil || s != nil {
+			t.Errorf("NewEd25519Signer accepted a %d-byte key", len(key))
+		}
+	}
+	s, err := umq.NewEd25519Signer("e1", priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alg, keyID, sig, err := s.Sign(context.Background(), []byte("data"))
+	if err != nil || alg != umq.SignatureEd25519 || keyID != "e1" || !ed25519.Verify(priv.Public().(ed25519.PublicKey), []byte("data"), sig) {
+		t.Errorf("Sign = %s %s %x %v", alg, keyID, sig, err)
+	}
+}
@@ -0,0 +1,42 @@
+package umq
+
+import "context"
+
+// SpanEnd 结束一个span，err为nil表示成功
+type SpanEnd func(err error)
+
+// Tracer SDK的链路追踪回调接口，通过UmqConfig.Tracer设置
+// 所有方法都可能被并发调用
+type Tracer interface {
+	// StartPublish 开始一次PublishMsg
+	// 写入carrier的键值（例如W3C traceparent）会封装进消息体传递给消费者
+	StartPublish(ctx context.Context, queueID string, carrier map[string]string) (context.Context, SpanEnd)
+	// StartGetMsg 开始一次GetMsg
+	StartGetMsg(ctx context.Context, queueID string, num int) (context.Context, SpanEnd)
+	// StartAck 开始一次AckMsg
+	StartAck(ctx context.Context, queueID, msgID string) (context.Context, SpanEnd)
+	// StartHandler 开始一次MsgHandler调用
+	// carrier为生产者写入的传播信息，消息未经SDK封装时为nil
+	StartHandler(ctx context.Context, queueID string, msg Message, carrier map[string]string) (context.Context, SpanEnd)
+}
+
+// nopTracer 未配置Tracer时使用的空实现
+type nopTracer struct{}
+
+func nopEnd(error) {}
+
+func (nopTracer) StartPublish(ctx context.Context, _ string, _ map[string]string) (context.Context, SpanEnd) {
+	return ctx, nopEnd
+}
+
+func (nopTracer) StartGetMsg(ctx context.Context, _ string, _ int) (context.Context, SpanEnd) {
+	return ctx, nopEnd
+}
+
+func (nopTracer) StartAck(ctx context.Context, _, _ string) (context.Context, SpanEnd) {
+	return ctx, nopEnd
+}
+
+func (nopTracer) StartHandler(ctx context.Context, _ string, _ Message, _ map[string]string) (context.Context, SpanEnd) {
+	return ctx, nopEnd
+}
@@ -0,0 +1,449 @@
+// Package umqbench 测量UMQ端到端的吞吐及延迟
+//
+// Run启动若干生产者及消费者，生产者在消息中写入发送时间，消费者收到后计算端到端延迟，
+// 最终汇总发布/消费速率、p50/p95/p99延迟、错误数及重连次数:
+//
+//	res, err := umqbench.Run(ctx, umqbench.Options{
+//		Config:        config,
+//		QueueID:       "umq-xxxx",
+//		ProducerID:    "...", ProducerToken: "...",
+//		ConsumerID:    "...", ConsumerToken: "...",
+//		Producers:     4, Consumers: 2, Messages: 10000,
+//	})
+package umqbench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+)
+
+// 默认参数
+const (
+	DefaultPayloadSize    = 256
+	DefaultDrainTimeout   = 10 * time.Second
+	DefaultConnectTimeout = 10 * time.Second
+)
+
+// messagePrefix 压测消息的前缀，消息格式为 umqbench:<run>:<seq>:<unix纳秒>:<填充>
+const messagePrefix = "umqbench:"
+
+// Options 压测参数
+type Options struct {
+	// 创建client使用的配置，Config.Metrics会与压测自身的统计同时生效
+	Config  umq.UmqConfig
+	QueueID string
+
+	ProducerID    string
+	ProducerToken string
+	ConsumerID    string
+	ConsumerToken string
+
+	// 并发的生产者及消费者数量，Consumers为0时只测试发布
+	Producers int
+	Consumers int
+
+	// 发送的消息总数，为0时以Duration为准
+	Messages int
+	// 发布持续的时间，Messages和Duration同时设置时先到者为准
+	Duration time.Duration
+	// 所有生产者合计每秒最多发布的消息数，0表示不限
+	Rate float64
+	// 每条消息的字节数，不足以容纳时间戳时按实际长度发送，默认为DefaultPayloadSize
+	PayloadSize int
+
+	// 发布结束后等待消费者收完消息的最长时间，默认为DefaultDrainTimeout
+	DrainTimeout time.Duration
+	// 等待所有消费者建立连接的最长时间，默认为DefaultConnectTimeout
+	ConnectTimeout time.Duration
+}
+
+// Latency 延迟分布，JSON中time.Duration以纳秒表示
+type Latency struct {
+	Min  time.Duration
+	Mean time.Duration
+	P50  time.Duration
+	P95  time.Duration
+	P99  time.Duration
+	Max  time.Duration
+}
+
+// Result 压测结果
+type Result struct {
+	QueueId   string
+	Producers int
+	Consumers int
+	// 从开始发布到消费结束（或发布结束）的时间
+	Duration time.Duration
+
+	Published     int64
+	PublishErrors int64
+	// 收到的本次压测的消息数（不含重复投递）
+	Received int64
+	// 同一条消息被重复投递的次数
+	Duplicates int64
+	// 发布结束后未在DrainTimeout内收到的消息数
+	Lost       int64
+	AckErrors  int64
+	Reconnects int64
+
+	// 每秒发布及消费的消息数
+	PublishRate float64
+	ConsumeRate float64
+
+	// PublishMsg调用的延迟
+	PublishLatency Latency
+	// 从发送到消费者收到的端到端延迟
+	EndToEndLatency Latency
+}
+
+// Run 执行一次压测，ctx取消时提前结束并返回已收集的结果
+func Run(ctx context.Context, opts Options) (*Result, error) {
+	if opts.Producers <= 0 {
+		return nil, errors.New("umqbench: Producers must be positive")
+	}
+	if opts.Messages <= 0 && opts.Duration <= 0 {
+		return nil, errors.New("umqbench: one of Messages or Duration is required")
+	}
+	if opts.PayloadSize <= 0 {
+		opts.PayloadSize = DefaultPayloadSize
+	}
+	if opts.DrainTimeout <= 0 {
+		opts.DrainTimeout = DefaultDrainTimeout
+	}
+	if opts.ConnectTimeout <= 0 {
+		opts.ConnectTimeout = DefaultConnectTimeout
+	}
+
+	b := &bench{
+		opts:      opts,
+		run:       strconv.FormatInt(rand.Int63(), 36),
+		seen:      make(map[int64]bool),
+		connected: make(chan struct{}, opts.Consumers),
+	}
+	config := opts.Config
+	b.next = config.Metrics
+	config.Metrics = b
+	client, err := umq.CreateClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	consumers, subErrs := b.subscribe(client)
+	defer b.unsubscribe(consumers)
+	if err := b.waitConnected(ctx, subErrs); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	b.publish(ctx, client)
+	publishElapsed := time.Since(start)
+	if opts.Consumers > 0 {
+		b.drain(ctx)
+	}
+	return b.result(time.Since(start), publishElapsed), nil
+}
+
+// bench 一次压测的状态，同时实现umq.Metrics以统计重连及ack失败
+type bench struct {
+	opts Options
+	run  string
+	next umq.Metrics
+
+	published     int64
+	publishErrors int64
+	duplicates    int64
+	ackErrors     int64
+	reconnects    int64
+	stopped       int32
+
+	mutex          sync.Mutex
+	seen           map[int64]bool
+	publishSamples []time.Duration
+	e2eSamples     []time.Duration
+	lastReceive    time.Time
+
+	connected chan struct{}
+}
+
+func (b *bench) subscribe(client *umq.UmqClient) ([]*umq.UmqConsumer, chan error) {
+	consumers := make([]*umq.UmqConsumer, b.opts.Consumers)
+	subErrs := make(chan error, b.opts.Consumers)
+	for i := range consumers {
+		consumer := client.NewConsumer(b.opts.ConsumerID, b.opts.ConsumerToken)
+		consumers[i] = consumer
+		go func() {
+			err := consumer.SubscribeQueue(b.opts.QueueID, b.handle)
+			if err != nil {
+				subErrs <- err
+			}
+		}()
+	}
+	return consumers, subErrs
+}
+
+func (b *bench) unsubscribe(consumers []*umq.UmqConsumer) {
+	atomic.StoreInt32(&b.stopped, 1)
+	for _, consumer := range consumers {
+		consumer.UnSubscribe(b.opts.QueueID)
+	}
+}
+
+func (b *bench) waitConnected(ctx context.Context, subErrs chan error) error {
+	timeout := time.NewTimer(b.opts.ConnectTimeout)
+	defer timeout.Stop()
+	for i := 0; i < b.opts.Consumers; i++ {
+		select {
+		case <-b.connected:
+		case err := <-subErrs:
+			return fmt.Errorf("umqbench: subscribe: %v", err)
+		case <-timeout.C:
+			return fmt.Errorf("umqbench: %d of %d consumers connected within %v", i, b.opts.Consumers, b.opts.ConnectTimeout)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// publish 启动所有生产者并等待发布结束
+func (b *bench) publish(ctx context.Context, client *umq.UmqClient) {
+	if b.opts.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.opts.Duration)
+		defer cancel()
+	}
+
+	var interval time.Duration
+	if b.opts.Rate > 0 {
+		interval = time.Duration(float64(time.Second) * float64(b.opts.Producers) / b.opts.Rate)
+	}
+	var seq int64
+	var wg sync.WaitGroup
+	for i := 0; i < b.opts.Producers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			producer := client.NewProducer(b.opts.ProducerID, b.opts.ProducerToken)
+			var tick <-chan time.Time
+			if interval > 0 {
+				ticker := time.NewTicker(interval)
+				defer ticker.Stop()
+				tick = ticker.C
+			}
+			for ctx.Err() == nil {
+				n := atomic.AddInt64(&seq, 1)
+				if b.opts.Messages > 0 && n > int64(b.opts.Messages) {
+					return
+				}
+				start := time.Now()
+				err := producer.PublishMsgContext(ctx, b.opts.QueueID, b.encode(n, start))
+				elapsed := time.Since(start)
+				if err != nil {
+					atomic.AddInt64(&b.publishErrors, 1)
+				} else {
+					atomic.AddInt64(&b.published, 1)
+					b.mutex.Lock()
+					b.publishSamples = append(b.publishSamples, elapsed)
+					b.mutex.Unlock()
+				}
+				if tick != nil {
+					select {
+					case <-tick:
+					case <-ctx.Done():
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// drain 等待消费者收到所有已发布的消息
+func (b *bench) drain(ctx context.Context) {
+	deadline := time.Now().Add(b.opts.DrainTimeout)
+	for time.Now().Before(deadline) && ctx.Err() == nil {
+		b.mutex.Lock()
+		received := int64(len(b.seen))
+		b.mutex.Unlock()
+		if received >= atomic.LoadInt64(&b.published) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (b *bench) encode(seq int64, sent time.Time) string {
+	msg := messagePrefix + b.run + ":" + strconv.FormatInt(seq, 10) + ":" + strconv.FormatInt(sent.UnixNano(), 10) + ":"
+	if pad := b.opts.PayloadSize - len(msg); pad > 0 {
+		msg += strings.Repeat("x", pad)
+	}
+	return msg
+}
+
+// decode 解析本次压测发出的消息，其他消息返回ok为false
+func (b *bench) decode(body string) (seq int64, sent time.Time, ok bool) {
+	fields := strings.SplitN(body, ":", 5)
+	if len(fields) != 5 || fields[0]+":" != messagePrefix || fields[1] != b.run {
+		return 0, time.Time{}, false
+	}
+	seq, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	return seq, time.Unix(0, nanos), true
+}
+
+func (b *bench) handle(c chan string, msg umq.Message) {
+	now := time.Now()
+	if seq, sent, ok := b.decode(msg.MsgBody); ok {
+		b.mutex.Lock()
+		if b.seen[seq] {
+			b.duplicates++
+		} else {
+			b.seen[seq] = true
+			b.e2eSamples = append(b.e2eSamples, now.Sub(sent))
+			b.lastReceive = now
+		}
+		b.mutex.Unlock()
+	}
+	// 其他来源的消息同样ack，避免残留消息影响下一次压测
+	if atomic.LoadInt32(&b.stopped) == 0 {
+		c <- msg.MsgId
+	}
+}
+
+func (b *bench) result(elapsed, publishElapsed time.Duration) *Result {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	res := &Result{
+		QueueId:         b.opts.QueueID,
+		Producers:       b.opts.Producers,
+		Consumers:       b.opts.Consumers,
+		Published:       atomic.LoadInt64(&b.published),
+		PublishErrors:   atomic.LoadInt64(&b.publishErrors),
+		Received:        int64(len(b.seen)),
+		Duplicates:      b.duplicates,
+		AckErrors:       atomic.LoadInt64(&b.ackErrors),
+		Reconnects:      atomic.LoadInt64(&b.reconnects),
+		PublishLatency:  summarize(b.publishSamples),
+		EndToEndLatency: summarize(b.e2eSamples),
+	}
+	res.Duration = publishElapsed
+	if b.opts.Consumers > 0 {
+		res.Duration = elapsed
+		if res.Lost = res.Published - res.Received; res.Lost < 0 {
+			res.Lost = 0
+		}
+	}
+	if publishElapsed > 0 {
+		res.PublishRate = float64(res.Published) / publishElapsed.Seconds()
+	}
+	if res.Received > 0 && !b.lastReceive.IsZero() {
+		// 消费速率按发布开始到最后一条消息收到计算，不包含drain的空等时间
+		consumeElapsed := elapsed - time.Since(b.lastReceive)
+		if consumeElapsed > 0 {
+			res.ConsumeRate = float64(res.Received) / consumeElapsed.Seconds()
+		}
+	}
+	return res
+}
+
+func summarize(samples []time.Duration) Latency {
+	if len(samples) == 0 {
+		return Latency{}
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	return Latency{
+		Min:  sorted[0],
+		Mean: total / time.Duration(len(sorted)),
+		P50:  percentile(sorted, 0.50),
+		P95:  percentile(sorted, 0.95),
+		P99:  percentile(sorted, 0.99),
+		Max:  sorted[len(sorted)-1],
+	}
+}
+
+// percentile 使用nearest-rank计算sorted的p分位数
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// 以下实现umq.Metrics，统计后转发给Options.Config.Metrics
+
+func (b *bench) PublishDone(queueID string, duration time.Duration, err error) {
+	if b.next != nil {
+		b.next.PublishDone(queueID, duration, err)
+	}
+}
+
+func (b *bench) MessageReceived(queueID string) {
+	if b.next != nil {
+		b.next.MessageReceived(queueID)
+	}
+}
+
+func (b *bench) HandlerDone(queueID string, duration time.Duration) {
+	if b.next != nil {
+		b.next.HandlerDone(queueID, duration)
+	}
+}
+
+func (b *bench) AckDone(queueID string, duration time.Duration, err error) {
+	if err != nil {
+		atomic.AddInt64(&b.ackErrors, 1)
+	}
+	if b.next != nil {
+		b.next.AckDone(queueID, duration, err)
+	}
+}
+
+func (b *bench) Reconnected(queueID string) {
+	atomic.AddInt64(&b.reconnects, 1)
+	if b.next != nil {
+		b.next.Reconnected(queueID)
+	}
+}
+
+func (b *bench) ConnectionState(queueID string, connected bool) {
+	if connected {
+		select {
+		case b.connected <- struct{}{}:
+		default:
+		}
+	}
+	if b.next != nil {
+		b.next.ConnectionState(queueID, connected)
+	}
+}
+
+func (b *bench) InFlight(queueID string, delta int) {
+	if b.next != nil {
+		b.next.InFlight(queueID, delta)
+	}
+}
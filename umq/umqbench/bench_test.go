@@ -0,0 +1,178 @@
+package umqbench
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+	"github.com/ucloud/umq-sdk-go/umq/umqtest"
+)
+
+// durations 返回1..n毫秒的有序样本
+func durations(n int) []time.Duration {
+	samples := make([]time.Duration, n)
+	for i := range samples {
+		samples[i] = time.Duration(i+1) * time.Millisecond
+	}
+	return samples
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		n    int
+		p    float64
+		want time.Duration
+	}{
+		{100, 0.50, 50 * time.Millisecond},
+		{100, 0.95, 95 * time.Millisecond},
+		{100, 0.99, 99 * time.Millisecond},
+		{10, 0.50, 5 * time.Millisecond},
+		{10, 0.95, 10 * time.Millisecond},
+		{10, 0.99, 10 * time.Millisecond},
+		{3, 0.50, 2 * time.Millisecond},
+		{1, 0.99, time.Millisecond},
+		{5, 0, time.Millisecond},
+		{5, 1, 5 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(durations(tt.n), tt.p); got != tt.want {
+			t.Errorf("percentile(1..%dms, %v) = %v, want %v", tt.n, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	if got := summarize(nil); got != (Latency{}) {
+		t.Errorf("summarize(nil) = %+v", got)
+	}
+	samples := []time.Duration{4 * time.Millisecond, time.Millisecond, 3 * time.Millisecond, 2 * time.Millisecond}
+	got := summarize(samples)
+	want := Latency{
+		Min:  time.Millisecond,
+		Mean: 2500 * time.Microsecond,
+		P50:  2 * time.Millisecond,
+		P95:  4 * time.Millisecond,
+		P99:  4 * time.Millisecond,
+		Max:  4 * time.Millisecond,
+	}
+	if got != want {
+		t.Errorf("summarize = %+v, want %+v", got, want)
+	}
+	if samples[0] != 4*time.Millisecond {
+		t.Error("summarize sorted the caller's samples")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	b := &bench{run: "r1", opts: Options{PayloadSize: 64}}
+	sent := time.Unix(0, 1700000000123456789)
+	body := b.encode(42, sent)
+	if len(body) != 64 {
+		t.Errorf("encoded %d bytes, want PayloadSize", len(body))
+	}
+	if seq, got, ok := b.decode(body); !ok || seq != 42 || !got.Equal(sent) {
+		t.Errorf("decode = %d %v %v", seq, got, ok)
+	}
+
+	other := &bench{run: "r2"}
+	for _, body := range []string{
+		other.encode(1, sent),
+		"hello",
+		"umqbench:r1:x:1:",
+		"umqbench:r1:1:x:",
+		"umqbench:r1:1:1",
+		"other:r1:1:1:",
+	} {
+		if _, _, ok := b.decode(body); ok {
+			t.Errorf("decode(%q) accepted a message that is not from this run", body)
+		}
+	}
+}
+
+func TestHandleCountsDuplicates(t *testing.T) {
+	b := &bench{run: "r1", seen: make(map[int64]bool)}
+	c := make(chan string, 10)
+	now := time.Now()
+	msgs := []umq.Message{
+		{MsgId: "1", MsgBody: b.encode(1, now)},
+		{MsgId: "2", MsgBody: b.encode(2, now)},
+		{MsgId: "3", MsgBody: b.encode(1, now)},
+		{MsgId: "4", MsgBody: (&bench{run: "r0"}).encode(1, now)},
+		{MsgId: "5", MsgBody: "not a bench message"},
+	}
+	for _, msg := range msgs {
+		b.handle(c, msg)
+		// 所有消息均ack，包括重复及其他来源的消息
+		if id := <-c; id != msg.MsgId {
+			t.Errorf("acked %q, want %q", id, msg.MsgId)
+		}
+	}
+
+	b.published = 3
+	b.opts.Consumers = 1
+	res := b.result(time.Second, time.Second)
+	if res.Received != 2 || res.Duplicates != 1 || res.Lost != 1 {
+		t.Errorf("Received %d, Duplicates %d, Lost %d, want 2, 1, 1", res.Received, res.Duplicates, res.Lost)
+	}
+	if len(b.e2eSamples) != 2 {
+		t.Errorf("%d latency samples, want one per distinct message", len(b.e2eSamples))
+	}
+
+	// 只发布时不计算丢失
+	b.opts.Consumers = 0
+	if res := b.result(time.Second, time.Second); res.Lost != 0 {
+		t.Errorf("Lost = %d without consumers", res.Lost)
+	}
+}
+
+func TestRunOptions(t *testing.T) {
+	for _, opts := range []Options{
+		{Messages: 1},
+		{Producers: 1},
+	} {
+		if _, err := Run(context.Background(), opts); err == nil {
+			t.Errorf("Run(%+v) succeeded", opts)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	srv := umqtest.NewServer()
+	defer srv.Close()
+	queueID := srv.CreateQueue("bench", "Direct")
+	producerID, producerToken := srv.CreateRole(queueID, "Pub")
+	consumerID, consumerToken := srv.CreateRole(queueID, "Sub")
+
+	// 上一次压测残留的消息，不应计入结果
+	client, err := umq.CreateClient(srv.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	leftover := (&bench{run: "old"}).encode(1, time.Now())
+	if err := client.NewProducer(producerID, producerToken).PublishMsg(queueID, leftover); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Run(context.Background(), Options{
+		Config:        srv.Config(),
+		QueueID:       queueID,
+		ProducerID:    producerID,
+		ProducerToken: producerToken,
+		ConsumerID:    consumerID,
+		ConsumerToken: consumerToken,
+		Producers:     2,
+		Consumers:     2,
+		Messages:      50,
+		DrainTimeout:  5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Published != 50 || res.PublishErrors != 0 || res.Received != 50 || res.Lost != 0 {
+		t.Errorf("result = %+v", res)
+	}
+	if res.EndToEndLatency.Max <= 0 || res.PublishLatency.P50 <= 0 || res.PublishRate <= 0 || res.ConsumeRate <= 0 {
+		t.Errorf("latency or rates missing: %+v", res)
+	}
+}
@@ -0,0 +1,107 @@
+// Package umqcodec 为umq提供类型化的消息编码
+//
+// 发布时使用Codec编码消息，并把Codec的ContentType写入Envelope；消费时按ContentType
+// 选择Codec解码后回调类型化的handler:
+//
+//	umqcodec.Publish(producer, queueID, Order{ID: 1})
+//	umqcodec.Subscribe(consumer, queueID, func(ctx context.Context, o Order) error {
+//		return process(ctx, o)
+//	})
+package umqcodec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"sync"
+)
+
+// Codec 消息内容的编码
+type Codec interface {
+	// ContentType 写入Envelope.ContentType，消费者据此选择解码的Codec
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// 内置Codec的ContentType
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeGob      = "application/x-gob"
+	ContentTypeMsgpack  = "application/msgpack"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// 内置的Codec
+var (
+	JSON     Codec = jsonCodec{}
+	Gob      Codec = gobCodec{}
+	Msgpack  Codec = msgpackCodec{}
+	Protobuf Codec = protobufCodec{}
+)
+
+var (
+	registryMutex sync.RWMutex
+	registry      = map[string]Codec{
+		ContentTypeJSON:     JSON,
+		ContentTypeGob:      Gob,
+		ContentTypeMsgpack:  Msgpack,
+		ContentTypeProtobuf: Protobuf,
+	}
+)
+
+// Register 注册自定义Codec，已存在相同ContentType时替换
+func Register(codec Codec) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	registry[normalizeContentType(codec.ContentType())] = codec
+}
+
+// Lookup 按ContentType查找已注册的Codec，忽略大小写及charset等参数
+func Lookup(contentType string) (Codec, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	codec, ok := registry[normalizeContentType(contentType)]
+	return codec, ok
+}
+
+func normalizeContentType(contentType string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// UnknownContentTypeError 消息的ContentType没有对应的Codec
+type UnknownContentTypeError struct {
+	ContentType string
+}
+
+func (e *UnknownContentTypeError) Error() string {
+	return fmt.Sprintf("umqcodec: no codec registered for content type %q", e.ContentType)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                        { return ContentTypeJSON }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) ContentType() string { return ContentTypeGob }
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
@@ -0,0 +1,131 @@
+package umqcodec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"unicode/utf8"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+)
+
+// Publish 使用JSON编码v并发布，producer可以是*umq.UmqProducer或*umqmock.Publisher
+func Publish[T any](producer umq.Publisher, queueID string, v T) error {
+	return PublishCodec(context.Background(), producer, queueID, v, JSON)
+}
+
+// PublishCodec 使用codec编码v并发布，ctx作为Tracer的父span
+func PublishCodec[T any](ctx context.Context, producer umq.Publisher, queueID string, v T, codec Codec) error {
+	env, err := Encode(v, codec)
+	if err != nil {
+		return err
+	}
+	return producer.PublishMessageContext(ctx, queueID, env)
+}
+
+// Encode 使用codec把v编码为Envelope，可在发布前补充其他字段
+func Encode(v interface{}, codec Codec) (umq.Envelope, error) {
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return umq.Envelope{}, err
+	}
+	// 编码结果不是合法UTF-8时（例如gob、msgpack）作为二进制消息发送
+	return umq.Envelope{
+		Body:        string(data),
+		ContentType: codec.ContentType(),
+		Binary:      !utf8.Valid(data),
+	}, nil
+}
+
+// Decode 按d的ContentType选择Codec，把消息内容解码为T
+// 没有ContentType的消息（例如普通字符串消息）使用fallback解码
+func Decode[T any](d umq.Delivery, fallback Codec) (T, error) {
+	var v T
+	codec := fallback
+	if d.ContentType != "" {
+		var ok bool
+		if codec, ok = Lookup(d.ContentType); !ok {
+			return v, &DecodeError{Delivery: d, Err: &UnknownContentTypeError{ContentType: d.ContentType}}
+		}
+	}
+
+	// T为指针时（例如protobuf消息）需要先分配再解码
+	target := interface{}(&v)
+	if t := reflect.TypeOf(v); t != nil && t.Kind() == reflect.Ptr {
+		v = reflect.New(t.Elem()).Interface().(T)
+		target = v
+	}
+	if err := codec.Unmarshal(d.Bytes(), target); err != nil {
+		return v, &DecodeError{Delivery: d, Err: err}
+	}
+	return v, nil
+}
+
+// DecodeError 消息解码失败
+type DecodeError struct {
+	Delivery umq.Delivery
+	Err      error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("umqcodec: decode message %s: %v", e.Delivery.MsgId, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Handler Subscribe的类型化回调，返回nil时ack消息
+type Handler[T any] func(ctx context.Context, v T) error
+
+// ErrorHandler 解码失败（*DecodeError）或Handler返回错误时调用，返回true时ack该消息，
+// 否则消息在ack超时后由服务端重新投递
+type ErrorHandler func(d umq.Delivery, err error) (ack bool)
+
+// DefaultErrorHandler ack无法解码的消息以免反复投递，Handler返回错误的消息不ack
+func DefaultErrorHandler(d umq.Delivery, err error) bool {
+	var decodeErr *DecodeError
+	return errors.As(err, &decodeErr)
+}
+
+// SubscribeOptions Subscribe的可选参数
+type SubscribeOptions struct {
+	// 消息没有ContentType时使用的Codec，默认为JSON
+	Fallback Codec
+	// 错误处理，默认为DefaultErrorHandler
+	ErrorHandler ErrorHandler
+}
+
+// Subscribe 订阅queueID，按消息的ContentType解码为T后回调handler，
+// consumer可以是*umq.UmqConsumer或*umqmock.Subscriber
+func Subscribe[T any](consumer umq.Subscriber, queueID string, handler Handler[T]) error {
+	return SubscribeWith(consumer, queueID, handler, SubscribeOptions{})
+}
+
+// SubscribeWith 同Subscribe，可指定fallback编码及错误处理
+func SubscribeWith[T any](consumer umq.Subscriber, queueID string, handler Handler[T], opts SubscribeOptions) error {
+	return consumer.SubscribeDelivery(queueID, DeliveryHandler(handler, opts))
+}
+
+// DeliveryHandler 把类型化的handler转换为umq.DeliveryHandler，可用于自行管理订阅
+func DeliveryHandler[T any](handler Handler[T], opts SubscribeOptions) umq.DeliveryHandler {
+	if opts.Fallback == nil {
+		opts.Fallback = JSON
+	}
+	if opts.ErrorHandler == nil {
+		opts.ErrorHandler = DefaultErrorHandler
+	}
+	return func(c chan string, d umq.Delivery) {
+		v, err := Decode[T](d, opts.Fallback)
+		if err == nil {
+			err = handler(d.Context(), v)
+		}
+		if err != nil && !opts.ErrorHandler(d, err) {
+			// 空字符串表示不ack
+			c <- ""
+			return
+		}
+		c <- d.MsgId
+	}
+}
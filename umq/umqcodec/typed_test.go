@@ -0,0 +1,90 @@
+package umqcodec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+	"github.com/ucloud/umq-sdk-go/umq/umqmock"
+)
+
+type point struct {
+	X, Y int
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for _, codec := range []Codec{JSON, Gob, Msgpack} {
+		env, err := Encode(point{1, 2}, codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Decode[point](umq.Delivery{Envelope: env}, JSON)
+		if err != nil {
+			t.Fatalf("%s: %v", codec.ContentType(), err)
+		}
+		if got != (point{1, 2}) {
+			t.Fatalf("%s: got %+v", codec.ContentType(), got)
+		}
+	}
+}
+
+func TestPublishSubscribeWithMock(t *testing.T) {
+	var p umqmock.Publisher
+	if err := PublishCodec(context.Background(), &p, "q", point{3, 4}, Gob); err != nil {
+		t.Fatal(err)
+	}
+	calls := p.Calls()
+	if len(calls) != 1 || calls[0].Method != "PublishMessageContext" || calls[0].Envelope.ContentType != ContentTypeGob {
+		t.Fatalf("calls = %+v", calls)
+	}
+
+	var s umqmock.Subscriber
+	got := make(chan point, 1)
+	err := Subscribe(&s, "q", func(ctx context.Context, v point) error {
+		got <- v
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 把发布的Envelope按消费者收到的格式投递
+	d := umq.Delivery{MsgId: "1", Envelope: calls[0].Envelope, Enveloped: true}
+	if id := deliver(&s, "q", d); id != "1" {
+		t.Fatalf("message acked as %q", id)
+	}
+	if v := <-got; v != (point{3, 4}) {
+		t.Fatalf("handler got %+v", v)
+	}
+}
+
+// deliver 调用Subscriber上最近一次订阅的DeliveryHandler，返回ack的消息ID
+func deliver(s *umqmock.Subscriber, queueID string, d umq.Delivery) string {
+	calls := s.Calls()
+	for i := len(calls) - 1; i >= 0; i-- {
+		if calls[i].QueueID == queueID && calls[i].DeliveryHandler != nil {
+			c := make(chan string, 1)
+			calls[i].DeliveryHandler(c, d)
+			return <-c
+		}
+	}
+	return ""
+}
+
+func TestDefaultErrorHandler(t *testing.T) {
+	decodeErr := &DecodeError{Err: errors.New("bad")}
+	tests := []struct {
+		err error
+		ack bool
+	}{
+		{decodeErr, true},
+		{fmt.Errorf("wrapped: %w", decodeErr), true},
+		{errors.New("handler failed"), false},
+	}
+	for _, tt := range tests {
+		if got := DefaultErrorHandler(umq.Delivery{}, tt.err); got != tt.ack {
+			t.Errorf("DefaultErrorHandler(%v) = %v, want %v", tt.err, got, tt.ack)
+		}
+	}
+}
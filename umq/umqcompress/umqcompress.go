@@ -0,0 +1,99 @@
+// Package umqcompress 为umq注册zstd及snappy压缩算法
+//
+// 生产者和消费者都需要导入该包，消费者才能自动解压:
+//
+//	import "github.com/ucloud/umq-sdk-go/umq/umqcompress"
+//
+//	config.Compression = umq.Compression{Algorithm: umqcompress.Zstd, Level: 3}
+package umqcompress
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+)
+
+// 注册的算法名称
+const (
+	// Zstd 级别为zstd的压缩级别 (1-22)，0表示默认级别3
+	Zstd = "zstd"
+	// Snappy 兼容snappy的块格式，级别1为默认速度，2为better，3为best
+	// best每次压缩都会分配数MB的临时内存，小消息用它得不偿失
+	Snappy = "snappy"
+)
+
+func init() {
+	umq.RegisterCompressor(Zstd, &zstdCompressor{encoders: make(map[zstd.EncoderLevel]*zstd.Encoder)})
+	umq.RegisterCompressor(Snappy, snappyCompressor{})
+}
+
+type zstdCompressor struct {
+	mutex    sync.Mutex
+	encoders map[zstd.EncoderLevel]*zstd.Encoder
+}
+
+// encoder 每个级别复用一个Encoder，EncodeAll可并发调用
+func (c *zstdCompressor) encoder(level int) (*zstd.Encoder, error) {
+	encLevel := zstd.SpeedDefault
+	if level != 0 {
+		encLevel = zstd.EncoderLevelFromZstd(level)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if enc, ok := c.encoders[encLevel]; ok {
+		return enc, nil
+	}
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(encLevel))
+	if err != nil {
+		return nil, err
+	}
+	c.encoders[encLevel] = enc
+	return enc, nil
+}
+
+func (c *zstdCompressor) Compress(src []byte, level int) ([]byte, error) {
+	enc, err := c.encoder(level)
+	if err != nil {
+		return nil, err
+	}
+	return enc.EncodeAll(src, nil), nil
+}
+
+func (c *zstdCompressor) Decompress(src []byte, maxSize int) ([]byte, error) {
+	dec, err := zstd.NewReader(bytes.NewReader(src), zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+	return umq.ReadLimited(dec, maxSize)
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) Compress(src []byte, level int) ([]byte, error) {
+	switch level {
+	case 0, 1:
+		return s2.EncodeSnappy(nil, src), nil
+	case 2:
+		return s2.EncodeSnappyBetter(nil, src), nil
+	case 3:
+		return s2.EncodeSnappyBest(nil, src), nil
+	}
+	return nil, fmt.Errorf("umqcompress: invalid snappy level %d", level)
+}
+
+func (snappyCompressor) Decompress(src []byte, maxSize int) ([]byte, error) {
+	size, err := s2.DecodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxSize {
+		return nil, umq.ErrDecompressedTooLarge
+	}
+	return s2.Decode(nil, src)
+}
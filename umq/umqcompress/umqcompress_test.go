@@ -0,0 +1,80 @@
+package umqcompress
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+)
+
+// sampleJSON 与umq包BenchmarkCompression使用的消息相同
+func sampleJSON(size int) []byte {
+	r := rand.New(rand.NewSource(1))
+	var b strings.Builder
+	b.WriteByte('[')
+	for i := 0; b.Len() < size; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `{"id":%d,"user":"user-%05d","event":"%s","amount":%d.%02d,"ts":%d}`,
+			i, r.Intn(100000), []string{"created", "paid", "shipped", "refunded"}[r.Intn(4)],
+			r.Intn(10000), r.Intn(100), 1700000000000+r.Int63n(1e9))
+	}
+	b.WriteByte(']')
+	return []byte(b.String())
+}
+
+var algorithms = []struct {
+	name   string
+	c      umq.Compressor
+	levels []int
+}{
+	{Zstd, &zstdCompressor{encoders: make(map[zstd.EncoderLevel]*zstd.Encoder)}, []int{1, 0, 9, 19}},
+	{Snappy, snappyCompressor{}, []int{1, 2, 3}},
+}
+
+func TestRoundTrip(t *testing.T) {
+	src := sampleJSON(16 << 10)
+	for _, a := range algorithms {
+		for _, level := range a.levels {
+			compressed, err := a.c.Compress(src, level)
+			if err != nil {
+				t.Fatalf("%s-%d: %v", a.name, level, err)
+			}
+			got, err := a.c.Decompress(compressed, len(src))
+			if err != nil || string(got) != string(src) {
+				t.Fatalf("%s-%d: round trip failed: %v", a.name, level, err)
+			}
+			if _, err := a.c.Decompress(compressed, len(src)-1); err != umq.ErrDecompressedTooLarge {
+				t.Fatalf("%s-%d: err = %v, want ErrDecompressedTooLarge", a.name, level, err)
+			}
+		}
+	}
+}
+
+// BenchmarkCompression 报告各算法及级别压缩后的大小占原始数据的百分比（wire%，不含base64及封装）及压缩速度
+func BenchmarkCompression(b *testing.B) {
+	for _, size := range []int{1536, 16 << 10} {
+		src := sampleJSON(size)
+		for _, a := range algorithms {
+			for _, level := range a.levels {
+				b.Run(fmt.Sprintf("%s-%d/%d", a.name, level, size), func(b *testing.B) {
+					var compressed []byte
+					b.SetBytes(int64(len(src)))
+					b.ReportAllocs()
+					for i := 0; i < b.N; i++ {
+						var err error
+						if compressed, err = a.c.Compress(src, level); err != nil {
+							b.Fatal(err)
+						}
+					}
+					b.ReportMetric(100*float64(len(compressed))/float64(len(src)), "wire%")
+				})
+			}
+		}
+	}
+}
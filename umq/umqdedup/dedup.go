@@ -0,0 +1,179 @@
+// Package umqdedup 在消费端按MsgId或封装中的幂等键跳过重复投递的消息
+//
+// UMQ在ack超时或重连后会重新投递未ack的消息，handler不幂等时可用Deduper包装:
+//
+//	store := umqdedup.NewMemoryStore(100000, time.Hour)
+//	dedup := umqdedup.New(store, umqdedup.Options{})
+//	consumer.SubscribeDelivery(queueID, dedup.Handler(handler))
+//
+// 消息在handler ack之后才记录为已处理，handler未ack的消息重新投递时仍会交给handler；
+// 重复的消息不调用handler，直接ack。handler尚未ack时收到的同一消息不调用handler也不ack，
+// 由服务端在ack超时后再次投递，届时按第一份的处理结果去重。
+package umqdedup
+
+import (
+	"sync"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+)
+
+// Store 记录已处理的去重键，实现须可并发调用
+type Store interface {
+	// Seen 判断key是否已处理过且未过期
+	Seen(key string) (bool, error)
+	// Mark 记录key已处理
+	Mark(key string) error
+}
+
+// KeyFunc 返回消息的去重键，返回空字符串时不去重
+type KeyFunc func(d umq.Delivery) string
+
+// DefaultKey 优先使用封装中的IdempotencyKey，没有时使用MsgId
+// 生产者重试产生的多条消息MsgId不同，只有IdempotencyKey能识别
+func DefaultKey(d umq.Delivery) string {
+	if d.IdempotencyKey != "" {
+		return "ik:" + d.IdempotencyKey
+	}
+	return "id:" + d.MsgId
+}
+
+// Options Deduper的可选参数
+type Options struct {
+	// 去重键，默认为DefaultKey
+	Key KeyFunc
+	// 跳过重复消息时调用，可为空
+	OnDuplicate func(d umq.Delivery)
+	// Store返回错误时调用，可为空；Seen失败时消息照常交给handler
+	OnError func(d umq.Delivery, err error)
+}
+
+// Deduper 按去重键跳过已处理的消息
+type Deduper struct {
+	store Store
+	opts  Options
+
+	mutex      sync.Mutex
+	inProgress map[string]struct{} // 已交给handler、尚未ack的键
+}
+
+// New 创建使用store的Deduper
+func New(store Store, opts Options) *Deduper {
+	if opts.Key == nil {
+		opts.Key = DefaultKey
+	}
+	return &Deduper{store: store, opts: opts, inProgress: make(map[string]struct{})}
+}
+
+// Seen 判断d是否已处理过，供GetMsg等自行处理消息的场景使用，处理完成后调用Done
+func (dd *Deduper) Seen(d umq.Delivery) bool {
+	key := dd.opts.Key(d)
+	if key == "" {
+		return false
+	}
+	seen, err := dd.store.Seen(key)
+	if err != nil {
+		dd.onError(d, err)
+		return false
+	}
+	if seen && dd.opts.OnDuplicate != nil {
+		dd.opts.OnDuplicate(d)
+	}
+	return seen
+}
+
+// Done 记录d已处理
+func (dd *Deduper) Done(d umq.Delivery) {
+	key := dd.opts.Key(d)
+	if key == "" {
+		return
+	}
+	if err := dd.store.Mark(key); err != nil {
+		dd.onError(d, err)
+	}
+}
+
+func (dd *Deduper) onError(d umq.Delivery, err error) {
+	if dd.opts.OnError != nil {
+		dd.opts.OnError(d, err)
+	}
+}
+
+// Handler 包装handler，重复的消息直接ack，其他消息在handler ack后记录为已处理
+// handler返回后才ack时由单独的goroutine等待，消息的Context结束（取消订阅）时不再等待
+func (dd *Deduper) Handler(handler umq.DeliveryHandler) umq.DeliveryHandler {
+	return func(c chan string, d umq.Delivery) {
+		key := dd.opts.Key(d)
+		if key == "" {
+			handler(c, d)
+			return
+		}
+		if !dd.reserve(key) {
+			// 同一消息的另一份正在处理，结果未知，不ack
+			if dd.opts.OnDuplicate != nil {
+				dd.opts.OnDuplicate(d)
+			}
+			c <- ""
+			return
+		}
+		if dd.Seen(d) {
+			dd.release(key)
+			c <- d.MsgId
+			return
+		}
+		inner := make(chan string, 1)
+		handler(inner, d)
+		select {
+		case msgID := <-inner:
+			dd.finish(c, d, key, msgID)
+		default:
+			go func() {
+				select {
+				case msgID := <-inner:
+					dd.finish(c, d, key, msgID)
+				case <-d.Context().Done():
+					dd.release(key)
+				}
+			}()
+		}
+	}
+}
+
+// MsgHandler 同Handler，用于SubscribeQueue的MsgHandler
+func (dd *Deduper) MsgHandler(handler umq.MsgHandler) umq.MsgHandler {
+	return func(c chan string, msg umq.Message) {
+		dd.Handler(func(inner chan string, _ umq.Delivery) {
+			handler(inner, msg)
+		})(c, msg.Delivery())
+	}
+}
+
+// reserve 把key记录为处理中，已在处理中时返回false
+func (dd *Deduper) reserve(key string) bool {
+	dd.mutex.Lock()
+	defer dd.mutex.Unlock()
+	if _, ok := dd.inProgress[key]; ok {
+		return false
+	}
+	dd.inProgress[key] = struct{}{}
+	return true
+}
+
+func (dd *Deduper) release(key string) {
+	dd.mutex.Lock()
+	delete(dd.inProgress, key)
+	dd.mutex.Unlock()
+}
+
+// finish 转发handler的ack结果，ack的消息先记录为已处理再解除处理中的状态，
+// 使之后投递的同一消息总能看到其中之一
+func (dd *Deduper) finish(c chan string, d umq.Delivery, key, msgID string) {
+	// 空字符串表示不ack
+	if msgID != "" {
+		dd.Done(d)
+	}
+	dd.release(key)
+	select {
+	case c <- msgID:
+	case <-d.Context().Done():
+	}
+}
@@ -0,0 +1,126 @@
+package umqdedup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+	"github.com/ucloud/umq-sdk-go/umq/umqtest"
+)
+
+func receive(t *testing.T, c chan string) string {
+	t.Helper()
+	select {
+	case msgID := <-c:
+		return msgID
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for ack")
+		return ""
+	}
+}
+
+func TestHandlerRedeliveryWhileInProgress(t *testing.T) {
+	dups := 0
+	dd := New(NewMemoryStore(100, time.Hour), Options{
+		OnDuplicate: func(umq.Delivery) { dups++ },
+	})
+	calls := 0
+	var pending chan string
+	h := dd.Handler(func(c chan string, d umq.Delivery) {
+		calls++
+		pending = c // 在handler返回之后才ack
+	})
+	d := umq.Delivery{MsgId: "m1"}
+	c := make(chan string, 1)
+
+	h(c, d)
+	// 第一份尚未ack时重新投递：不调用handler，也不ack
+	h(c, d)
+	if got := receive(t, c); got != "" {
+		t.Fatalf("redelivery while in progress acked %q", got)
+	}
+	if calls != 1 || dups != 1 {
+		t.Fatalf("calls = %d, duplicates = %d, want 1, 1", calls, dups)
+	}
+
+	pending <- d.MsgId
+	if got := receive(t, c); got != d.MsgId {
+		t.Fatalf("ack = %q, want %q", got, d.MsgId)
+	}
+	// 第一份ack之后的重新投递按已处理直接ack
+	h(c, d)
+	if got := receive(t, c); got != d.MsgId {
+		t.Fatalf("duplicate ack = %q, want %q", got, d.MsgId)
+	}
+	if calls != 1 {
+		t.Fatalf("handler called %d times, want 1", calls)
+	}
+}
+
+func TestHandlerNackReleasesKey(t *testing.T) {
+	dd := New(NewMemoryStore(100, time.Hour), Options{})
+	calls := 0
+	h := dd.Handler(func(c chan string, d umq.Delivery) {
+		calls++
+		if calls == 1 {
+			c <- ""
+			return
+		}
+		c <- d.MsgId
+	})
+	d := umq.Delivery{MsgId: "m1"}
+	c := make(chan string, 1)
+	h(c, d)
+	if got := receive(t, c); got != "" {
+		t.Fatalf("ack = %q, want none", got)
+	}
+	h(c, d)
+	if got := receive(t, c); got != d.MsgId || calls != 2 {
+		t.Fatalf("ack = %q after %d calls, want %q after 2", got, calls, d.MsgId)
+	}
+}
+
+func TestHandlerStopsWaitingAfterUnsubscribe(t *testing.T) {
+	srv := umqtest.NewServer()
+	defer srv.Close()
+	queueID := srv.CreateQueue("test", "Direct")
+	producerID, producerToken := srv.CreateRole(queueID, "Pub")
+	consumerID, consumerToken := srv.CreateRole(queueID, "Sub")
+	client, err := umq.CreateClient(srv.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumer := client.NewConsumer(consumerID, consumerToken)
+	if err := client.NewProducer(producerID, producerToken).PublishMsg(queueID, "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	dd := New(NewMemoryStore(100, time.Hour), Options{})
+	received := make(chan struct{}, 1)
+	// handler始终不ack
+	go consumer.SubscribeDelivery(queueID, dd.Handler(func(c chan string, d umq.Delivery) {
+		received <- struct{}{}
+	}))
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+	if err := consumer.UnSubscribe(queueID); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		dd.mutex.Lock()
+		n := len(dd.inProgress)
+		dd.mutex.Unlock()
+		if n == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("key still in progress after unsubscribe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,176 @@
+package umqdedup
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// compactMinRecords 文件中的记录数超过该值且超过有效键数的两倍时重写文件
+const compactMinRecords = 1024
+
+// FileStore 把已处理的键追加写入文件的Store，进程重启后仍能去重，键在ttl后过期
+// 所有键同时保存在内存中；写入不做fsync，机器掉电时可能丢失最后的记录
+// 同一文件只能由一个FileStore打开
+type FileStore struct {
+	mutex   sync.Mutex
+	path    string
+	ttl     time.Duration
+	file    *os.File
+	keys    map[string]int64 // 过期时间，unix毫秒，0表示不过期
+	records int              // 文件中的记录数
+	// 上次重写文件的时间，每隔ttl重写一次以清理过期的键
+	compacted time.Time
+}
+
+// OpenFileStore 打开或创建path处的FileStore，ttl<=0时不过期
+func OpenFileStore(path string, ttl time.Duration) (*FileStore, error) {
+	s := &FileStore{path: path, ttl: ttl, keys: make(map[string]int64)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load 读取文件中未过期的记录，不完整或无法解析的行（例如写入时进程崩溃）被忽略
+func (s *FileStore) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	now := time.Now().UnixMilli()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		expires, key, ok := parseRecord(scanner.Text())
+		if ok && (expires == 0 || expires > now) {
+			s.keys[key] = expires
+		}
+	}
+	return scanner.Err()
+}
+
+// 每行一条记录: <过期时间> <带引号的键>
+func formatRecord(key string, expires int64) string {
+	return strconv.FormatInt(expires, 10) + " " + strconv.Quote(key) + "\n"
+}
+
+func parseRecord(line string) (expires int64, key string, ok bool) {
+	ts, quoted, found := strings.Cut(line, " ")
+	if !found {
+		return 0, "", false
+	}
+	expires, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	if key, err = strconv.Unquote(quoted); err != nil {
+		return 0, "", false
+	}
+	return expires, key, true
+}
+
+// compact 去掉过期的键，重写文件后继续追加
+// 新文件写入并改名成功后才替换s.file，失败时保留原文件，之后的记录继续追加到原文件
+func (s *FileStore) compact() error {
+	now := time.Now().UnixMilli()
+	tmp := s.path + ".tmp"
+	// 改名后句柄仍指向同一文件，直接用于之后的追加
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("umqdedup: compact %s: %v", s.path, err)
+	}
+	w := bufio.NewWriter(f)
+	for key, expires := range s.keys {
+		if expires != 0 && expires <= now {
+			delete(s.keys, key)
+			continue
+		}
+		w.WriteString(formatRecord(key, expires))
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, s.path)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("umqdedup: compact %s: %v", s.path, err)
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = f
+	s.records = len(s.keys)
+	s.compacted = time.Now()
+	return nil
+}
+
+func (s *FileStore) Seen(key string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	expires, ok := s.keys[key]
+	if !ok {
+		return false, nil
+	}
+	if expires != 0 && expires <= time.Now().UnixMilli() {
+		delete(s.keys, key)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (s *FileStore) Mark(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	var expires int64
+	if s.ttl > 0 {
+		expires = time.Now().Add(s.ttl).UnixMilli()
+	}
+	s.keys[key] = expires
+	// 每条记录立即写入文件，进程崩溃时不丢失
+	if _, err := s.file.WriteString(formatRecord(key, expires)); err != nil {
+		return err
+	}
+	s.records++
+	if s.records > compactMinRecords && s.records > 2*len(s.keys) ||
+		s.ttl > 0 && time.Since(s.compacted) > s.ttl {
+		return s.compact()
+	}
+	return nil
+}
+
+// Len 返回当前保存的键数，包括已过期但尚未清理的键
+func (s *FileStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.keys)
+}
+
+// Close 关闭文件，之后Mark返回错误
+func (s *FileStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
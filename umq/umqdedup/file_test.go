@@ -0,0 +1,81 @@
+package umqdedup
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFileStoreCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.log")
+	s, err := OpenFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3*compactMinRecords; i++ {
+		if err := s.Mark(strconv.Itoa(i % 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.records > compactMinRecords+1 {
+		t.Errorf("%d records in file, compaction did not run", s.records)
+	}
+	s.Close()
+
+	s, err = OpenFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Len() != 100 {
+		t.Fatalf("reopened store has %d keys, want 100", s.Len())
+	}
+}
+
+func TestFileStoreCompactFailureKeepsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.log")
+	s, err := OpenFileStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 临时文件的路径被目录占用，重写文件失败
+	if err := os.Mkdir(path+".tmp", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var compactErr error
+	for i := 0; i <= compactMinRecords; i++ {
+		if err := s.Mark("same"); err != nil {
+			compactErr = err
+		}
+	}
+	if compactErr == nil {
+		t.Fatal("compaction into a directory succeeded")
+	}
+	// 失败后仍写入原文件
+	if err := s.Mark("after"); err == nil {
+		t.Fatal("compaction should still be failing")
+	}
+	if s.file == nil {
+		t.Fatal("file handle dropped after failed compaction")
+	}
+	if err := os.Remove(path + ".tmp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Mark("last"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s, err = OpenFileStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for _, key := range []string{"same", "after", "last"} {
+		if ok, _ := s.Seen(key); !ok {
+			t.Errorf("key %q lost", key)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package umqdedup
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// MemoryStore 进程内的Store，最多保存capacity个键，超出时淘汰最久未使用的键，键在ttl后过期
+// 进程重启后记录丢失，需要跨重启去重时使用FileStore
+type MemoryStore struct {
+	mutex    sync.Mutex
+	capacity int
+	ttl      time.Duration
+	lru      *list.List // 最近使用的在前
+	entries  map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key     string
+	expires time.Time
+}
+
+// NewMemoryStore 创建MemoryStore，capacity<=0时不限制数量，ttl<=0时不过期
+func NewMemoryStore(capacity int, ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		capacity: capacity,
+		ttl:      ttl,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryStore) Seen(key string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return false, nil
+	}
+	if s.expired(e.Value.(*memoryEntry)) {
+		s.remove(e)
+		return false, nil
+	}
+	s.lru.MoveToFront(e)
+	return true, nil
+}
+
+func (s *MemoryStore) Mark(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var expires time.Time
+	if s.ttl > 0 {
+		expires = time.Now().Add(s.ttl)
+	}
+	if e, ok := s.entries[key]; ok {
+		e.Value.(*memoryEntry).expires = expires
+		s.lru.MoveToFront(e)
+		return nil
+	}
+	s.entries[key] = s.lru.PushFront(&memoryEntry{key: key, expires: expires})
+	for s.capacity > 0 && s.lru.Len() > s.capacity {
+		s.remove(s.lru.Back())
+	}
+	// 顺带清理最久未使用且已过期的键，不设capacity时也不会无限增长
+	for back := s.lru.Back(); back != nil && s.expired(back.Value.(*memoryEntry)); back = s.lru.Back() {
+		s.remove(back)
+	}
+	return nil
+}
+
+// Len 返回当前保存的键数，包括已过期但尚未清理的键
+func (s *MemoryStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lru.Len()
+}
+
+func (s *MemoryStore) expired(e *memoryEntry) bool {
+	return !e.expires.IsZero() && !time.Now().Before(e.expires)
+}
+
+func (s *MemoryStore) remove(e *list.Element) {
+	s.lru.Remove(e)
+	delete(s.entries, e.Value.(*memoryEntry).key)
+}
@@ -0,0 +1,126 @@
+// Package umqfault 提供用于混沌测试的故障注入：包装HTTP Transport及websocket拨号，
+// 按规则延迟响应、返回非0的RetCode、断开连接或重复投递消息。
+//
+// 典型用法:
+//
+//	inj := umqfault.New(1)
+//	inj.Add(umqfault.Rule{Action: "PublishMsg", Probability: 0.1, RetCode: 5000})
+//	inj.Add(umqfault.Rule{Action: umqfault.WebsocketAction, Every: 20, Drop: true})
+//	config.HTTPTransport = inj.RoundTripper(nil)
+//	config.WebsocketDialer = inj.WebsocketDialer()
+package umqfault
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// WebsocketAction websocket上服务端推送的每一帧数据都以该Action匹配规则
+const WebsocketAction = "websocket"
+
+// ErrInjected 注入的连接故障返回的错误
+var ErrInjected = errors.New("umqfault: injected connection failure")
+
+// Rule 一条故障注入规则
+type Rule struct {
+	// 匹配的Action，例如 PublishMsg、AckMsg 或 WebsocketAction，为空时匹配全部
+	Action string
+	// 每次匹配时触发的概率，取值 (0, 1]
+	Probability float64
+	// 每匹配Every次触发一次，Probability及Every均为0时每次都触发
+	Every int
+	// 最多触发的次数，0表示不限
+	Times int
+
+	// 触发时延迟的时间
+	Delay time.Duration
+	// 非0时不发送请求，直接返回该RetCode (仅HTTP)
+	RetCode int
+	// 返回RetCode时附带的错误信息
+	Message string
+	// HTTP: 不发送请求直接返回ErrInjected；websocket: 在帧的中间断开连接
+	Drop bool
+	// 仅HTTP: 发送请求但丢弃响应并返回ErrInjected，用于模拟服务端已处理但客户端超时
+	DropResponse bool
+	// 仅websocket: 将完整的数据帧重复投递一次
+	Duplicate bool
+}
+
+type ruleState struct {
+	Rule
+	matched int
+	fired   int
+}
+
+// Injector 按规则注入故障，可同时用于HTTP及websocket
+type Injector struct {
+	mu    sync.Mutex
+	rand  *rand.Rand
+	rules []*ruleState
+}
+
+// New 创建Injector，seed用于按概率触发的规则，相同的seed得到相同的触发序列
+func New(seed int64) *Injector {
+	return &Injector{rand: rand.New(rand.NewSource(seed))}
+}
+
+// Add 添加一条规则，规则按添加顺序匹配，第一条触发的规则生效
+func (in *Injector) Add(r Rule) {
+	in.mu.Lock()
+	in.rules = append(in.rules, &ruleState{Rule: r})
+	in.mu.Unlock()
+}
+
+// Reset 清除所有规则
+func (in *Injector) Reset() {
+	in.mu.Lock()
+	in.rules = nil
+	in.mu.Unlock()
+}
+
+// Fired 返回action上已触发的故障次数
+func (in *Injector) Fired(action string) int {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	n := 0
+	for _, r := range in.rules {
+		if r.Action == action {
+			n += r.fired
+		}
+	}
+	return n
+}
+
+// match 返回对action触发的规则，没有时返回nil
+func (in *Injector) match(action string, accept func(*Rule) bool) *Rule {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for _, r := range in.rules {
+		if r.Action != "" && r.Action != action {
+			continue
+		}
+		if !accept(&r.Rule) {
+			continue
+		}
+		if r.Times > 0 && r.fired >= r.Times {
+			continue
+		}
+		r.matched++
+		switch {
+		case r.Every > 0:
+			if r.matched%r.Every != 0 {
+				continue
+			}
+		case r.Probability > 0:
+			if in.rand.Float64() >= r.Probability {
+				continue
+			}
+		}
+		r.fired++
+		fired := r.Rule
+		return &fired
+	}
+	return nil
+}
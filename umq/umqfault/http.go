@@ -0,0 +1,91 @@
+package umqfault
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// RoundTripper 返回注入HTTP故障的Transport，next为空时使用http.DefaultTransport
+func (in *Injector) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &roundTripper{in: in, next: next}
+}
+
+type roundTripper struct {
+	in   *Injector
+	next http.RoundTripper
+}
+
+func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req, action, err := requestAction(req)
+	if err != nil {
+		return nil, err
+	}
+	r := rt.in.match(action, func(r *Rule) bool { return !r.Duplicate })
+	if r == nil {
+		return rt.next.RoundTrip(req)
+	}
+	if r.Delay > 0 {
+		select {
+		case <-time.After(r.Delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	switch {
+	case r.Drop:
+		return nil, ErrInjected
+	case r.RetCode != 0:
+		body, _ := json.Marshal(map[string]interface{}{
+			"Action":  action + "Response",
+			"RetCode": r.RetCode,
+			"Message": r.Message,
+		})
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"application/json"}},
+			Body:          ioutil.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	case r.DropResponse:
+		resp, err := rt.next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		return nil, ErrInjected
+	}
+	return rt.next.RoundTrip(req)
+}
+
+// requestAction 返回请求的Action，GET在查询串中，POST在JSON请求体中
+// 读取请求体后返回带有相同内容的新请求，原请求不被修改
+func requestAction(req *http.Request) (*http.Request, string, error) {
+	if action := req.URL.Query().Get("Action"); action != "" || req.Method != http.MethodPost || req.Body == nil {
+		return req, action, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	var params map[string]string
+	json.Unmarshal(body, &params)
+	req = req.Clone(req.Context())
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return req, params["Action"], nil
+}
@@ -0,0 +1,48 @@
+package umqfault
+
+import (
+	"testing"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+	"github.com/ucloud/umq-sdk-go/umq/umqtest"
+)
+
+func TestRoundTripperMatchesAction(t *testing.T) {
+	for _, method := range []string{umq.HTTPMethodGet, umq.HTTPMethodPost} {
+		t.Run(method, func(t *testing.T) {
+			srv := umqtest.NewServer()
+			defer srv.Close()
+			queueID := srv.CreateQueue("test", "Direct")
+			producerID, producerToken := srv.CreateRole(queueID, "Pub")
+			consumerID, consumerToken := srv.CreateRole(queueID, "Sub")
+
+			inj := New(1)
+			inj.Add(Rule{Action: "PublishMsg", Times: 1, RetCode: 5000, Message: "injected"})
+			config := srv.Config()
+			config.HTTPMethod = method
+			config.HTTPTransport = inj.RoundTripper(nil)
+			client, err := umq.CreateClient(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			producer := client.NewProducer(producerID, producerToken)
+			if err := producer.PublishMsg(queueID, "first"); err == nil {
+				t.Fatal("injected RetCode was not returned")
+			}
+			if inj.Fired("PublishMsg") != 1 {
+				t.Fatalf("fired %d times, want 1", inj.Fired("PublishMsg"))
+			}
+			// 未触发规则的请求体须原样发送
+			if err := producer.PublishMsg(queueID, "second"); err != nil {
+				t.Fatal(err)
+			}
+			info, err := client.NewConsumer(consumerID, consumerToken).GetMsg(queueID, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(info.Msgs) != 1 || info.Msgs[0].MsgBody != "second" {
+				t.Fatalf("got %+v, want the second message only", info.Msgs)
+			}
+		})
+	}
+}
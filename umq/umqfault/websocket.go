@@ -0,0 +1,138 @@
+package umqfault
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+	"github.com/ucloud/umq-sdk-go/umq/websocket"
+)
+
+// WebsocketDialer 返回注入websocket故障的拨号函数，可设置到UmqConfig.WebsocketDialer
+// 握手完成之后，服务端发来的每一帧都以WebsocketAction匹配规则
+func (in *Injector) WebsocketDialer() umq.WebsocketDialFunc {
+	return func(ctx context.Context, config *websocket.Config) (*websocket.Conn, error) {
+		conn, err := config.DialNet(ctx)
+		if err != nil {
+			return nil, &websocket.DialError{Config: config, Err: err}
+		}
+		fc := &faultConn{Conn: conn, in: in}
+		fc.br = bufio.NewReader(conn)
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		ws, err := websocket.NewClient(config, fc)
+		if err != nil {
+			conn.Close()
+			return nil, &websocket.DialError{Config: config, Err: err}
+		}
+		conn.SetDeadline(time.Time{})
+		fc.mu.Lock()
+		fc.active = true
+		fc.mu.Unlock()
+		return ws, nil
+	}
+}
+
+// faultConn 在握手完成后逐帧读取服务端数据，并按规则延迟、截断或重复
+type faultConn struct {
+	net.Conn
+	in *Injector
+	br *bufio.Reader
+
+	mu      sync.Mutex
+	active  bool
+	pending []byte
+	broken  bool
+}
+
+func (c *faultConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.active {
+		return c.br.Read(p)
+	}
+	for len(c.pending) == 0 {
+		if c.broken {
+			return 0, ErrInjected
+		}
+		frame, err := readFrame(c.br)
+		if err != nil {
+			return 0, err
+		}
+		c.pending = c.apply(frame)
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// apply 对一帧数据应用触发的规则，返回交给websocket层的数据
+func (c *faultConn) apply(frame []byte) []byte {
+	complete := frame[0]&0x80 != 0 && (frame[0]&0x0f == websocket.TextFrame || frame[0]&0x0f == websocket.BinaryFrame)
+	r := c.in.match(WebsocketAction, func(r *Rule) bool {
+		return !r.Duplicate || complete
+	})
+	if r == nil {
+		return frame
+	}
+	if r.Delay > 0 {
+		time.Sleep(r.Delay)
+	}
+	switch {
+	case r.Drop:
+		c.broken = true
+		c.Conn.Close()
+		return frame[:len(frame)/2]
+	case r.Duplicate:
+		return append(frame, frame...)
+	}
+	return frame
+}
+
+// readFrame 读取一个完整的websocket帧，包括帧头
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	header := make([]byte, 2, 14)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return nil, err
+		}
+		header = append(header, ext...)
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return nil, err
+		}
+		header = append(header, ext...)
+		length = binary.BigEndian.Uint64(ext)
+	}
+	// 长度来自对端，超过websocket层接受的上限时直接返回错误，不按该长度分配内存
+	if length > websocket.MaxFramePayloadLength {
+		return nil, websocket.ErrFrameTooLarge
+	}
+	if header[1]&0x80 != 0 {
+		key := make([]byte, 4)
+		if _, err := io.ReadFull(r, key); err != nil {
+			return nil, err
+		}
+		header = append(header, key...)
+	}
+	frame := make([]byte, len(header)+int(length))
+	copy(frame, header)
+	if _, err := io.ReadFull(r, frame[len(header):]); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
@@ -0,0 +1,31 @@
+package umqfault
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ucloud/umq-sdk-go/umq/websocket"
+)
+
+func TestReadFrame(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 300)
+	wire := append([]byte{0x82, 126, 0x01, 0x2c}, payload...)
+	frame, err := readFrame(bufio.NewReader(bytes.NewReader(wire)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(frame, wire) {
+		t.Fatalf("frame = %d bytes, want %d", len(frame), len(wire))
+	}
+}
+
+func TestReadFrameRejectsOversizedLength(t *testing.T) {
+	for _, length := range []uint64{websocket.MaxFramePayloadLength + 1, 1 << 62, 1<<64 - 1} {
+		wire := binary.BigEndian.AppendUint64([]byte{0x82, 127}, length)
+		if _, err := readFrame(bufio.NewReader(bytes.NewReader(wire))); err != websocket.ErrFrameTooLarge {
+			t.Errorf("length %d: err = %v, want ErrFrameTooLarge", length, err)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+// Package umqmock 提供umq中Publisher、Subscriber、Acker及QueueAdmin接口的内存实现，
+// 记录每一次调用，测试中可通过各mock的Calls方法取得记录进行断言。
+// 返回值可通过Func字段自定义，同一类方法（例如各发布方法）共用一个Func，未设置时返回零值。
+package umqmock
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+)
+
+// PublishCall Publisher上的一次调用
+type PublishCall struct {
+	// 调用的方法名，例如PublishMsg、PublishMessageContext
+	Method  string
+	QueueID string
+	// 发布的内容，PublishMsg只设置Body，PublishBytes的Body为原始字节且Binary为true
+	Envelope umq.Envelope
+}
+
+// Publisher umq.Publisher的mock实现
+type Publisher struct {
+	mu    sync.Mutex
+	calls []PublishCall
+
+	// 所有发布方法共用，未设置时返回Attempts为1的PublishResult
+	PublishFunc func(ctx context.Context, queueID string, env umq.Envelope) (umq.PublishResult, error)
+}
+
+// Calls 返回调用记录的副本
+func (m *Publisher) Calls() []PublishCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]PublishCall(nil), m.calls...)
+}
+
+func (m *Publisher) publish(ctx context.Context, method, queueID string, env umq.Envelope) (umq.PublishResult, error) {
+	m.mu.Lock()
+	m.calls = append(m.calls, PublishCall{Method: method, QueueID: queueID, Envelope: env})
+	f := m.PublishFunc
+	m.mu.Unlock()
+	if f != nil {
+		return f(ctx, queueID, env)
+	}
+	return umq.PublishResult{IdempotencyKey: env.IdempotencyKey, Attempts: 1}, nil
+}
+
+// PublishMsg 记录调用并返回PublishFunc的结果
+func (m *Publisher) PublishMsg(queueID, content string) error {
+	_, err := m.publish(context.Background(), "PublishMsg", queueID, umq.Envelope{Body: content})
+	return err
+}
+
+// PublishMsgContext 记录调用并返回PublishFunc的结果
+func (m *Publisher) PublishMsgContext(ctx context.Context, queueID, content string) error {
+	_, err := m.publish(ctx, "PublishMsgContext", queueID, umq.Envelope{Body: content})
+	return err
+}
+
+// PublishMsgResult 记录调用并返回PublishFunc的结果
+func (m *Publisher) PublishMsgResult(ctx context.Context, queueID, content string) (umq.PublishResult, error) {
+	return m.publish(ctx, "PublishMsgResult", queueID, umq.Envelope{Body: content})
+}
+
+// PublishMessage 记录调用并返回PublishFunc的结果
+func (m *Publisher) PublishMessage(queueID string, env umq.Envelope) error {
+	_, err := m.publish(context.Background(), "PublishMessage", queueID, env)
+	return err
+}
+
+// PublishMessageContext 记录调用并返回PublishFunc的结果
+func (m *Publisher) PublishMessageContext(ctx context.Context, queueID string, env umq.Envelope) error {
+	_, err := m.publish(ctx, "PublishMessageContext", queueID, env)
+	return err
+}
+
+// PublishMessageResult 记录调用并返回PublishFunc的结果
+func (m *Publisher) PublishMessageResult(ctx context.Context, queueID string, env umq.Envelope) (umq.PublishResult, error) {
+	return m.publish(ctx, "PublishMessageResult", queueID, env)
+}
+
+// PublishBytes 记录调用并返回PublishFunc的结果
+func (m *Publisher) PublishBytes(queueID string, payload []byte) error {
+	_, err := m.publish(context.Background(), "PublishBytes", queueID, umq.Envelope{Body: string(payload), Binary: true})
+	return err
+}
+
+// PublishBytesContext 记录调用并返回PublishFunc的结果
+func (m *Publisher) PublishBytesContext(ctx context.Context, queueID string, payload []byte) error {
+	_, err := m.publish(ctx, "PublishBytesContext", queueID, umq.Envelope{Body: string(payload), Binary: true})
+	return err
+}
+
+// SubscriberCall Subscriber上的一次调用，未用到的参数为零值
+type SubscriberCall struct {
+	// SubscribeQueue、SubscribeDelivery、SubscribeBytes、UnSubscribe、GetMsg或GetMsgContext
+	Method  string
+	QueueID string
+	// 订阅方法注册的回调，按方法设置其中之一
+	MsgHandler      umq.MsgHandler
+	DeliveryHandler umq.DeliveryHandler
+	BytesHandler    umq.BytesHandler
+	Num             int
+}
+
+// Subscriber umq.Subscriber的mock实现
+type Subscriber struct {
+	mu    sync.Mutex
+	calls []SubscriberCall
+
+	// 三种订阅方法共用，未设置时立即返回nil
+	SubscribeFunc   func(call SubscriberCall) error
+	UnSubscribeFunc func(queueID string) error
+	// GetMsg及GetMsgContext共用，未设置时返回空的MessageInfo
+	GetMsgFunc func(queueID string, num int) (*umq.MessageInfo, error)
+}
+
+// Calls 返回调用记录的副本
+func (m *Subscriber) Calls() []SubscriberCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]SubscriberCall(nil), m.calls...)
+}
+
+func (m *Subscriber) subscribe(call SubscriberCall) error {
+	m.mu.Lock()
+	m.calls = append(m.calls, call)
+	f := m.SubscribeFunc
+	m.mu.Unlock()
+	if f != nil {
+		return f(call)
+	}
+	return nil
+}
+
+// SubscribeQueue 记录调用并返回SubscribeFunc的结果
+func (m *Subscriber) SubscribeQueue(queueID string, msgHandler umq.MsgHandler) error {
+	return m.subscribe(SubscriberCall{Method: "SubscribeQueue", QueueID: queueID, MsgHandler: msgHandler})
+}
+
+// SubscribeDelivery 记录调用并返回SubscribeFunc的结果
+func (m *Subscriber) SubscribeDelivery(queueID string, handler umq.DeliveryHandler) error {
+	return m.subscribe(SubscriberCall{Method: "SubscribeDelivery", QueueID: queueID, DeliveryHandler: handler})
+}
+
+// SubscribeBytes 记录调用并返回SubscribeFunc的结果
+func (m *Subscriber) SubscribeBytes(queueID string, handler umq.BytesHandler) error {
+	return m.subscribe(SubscriberCall{Method: "SubscribeBytes", QueueID: queueID, BytesHandler: handler})
+}
+
+// UnSubscribe 记录调用并返回UnSubscribeFunc的结果
+func (m *Subscriber) UnSubscribe(queueID string) error {
+	m.mu.Lock()
+	m.calls = append(m.calls, SubscriberCall{Method: "UnSubscribe", QueueID: queueID})
+	f := m.UnSubscribeFunc
+	m.mu.Unlock()
+	if f != nil {
+		return f(queueID)
+	}
+	return nil
+}
+
+// GetMsg 记录调用并返回GetMsgFunc的结果
+func (m *Subscriber) GetMsg(queueID string, num int) (*umq.MessageInfo, error) {
+	return m.getMsg("GetMsg", queueID, num)
+}
+
+// GetMsgContext 记录调用并返回GetMsgFunc的结果
+func (m *Subscriber) GetMsgContext(ctx context.Context, queueID string, num int) (*umq.MessageInfo, error) {
+	return m.getMsg("GetMsgContext", queueID, num)
+}
+
+func (m *Subscriber) getMsg(method, queueID string, num int) (*umq.MessageInfo, error) {
+	m.mu.Lock()
+	m.calls = append(m.calls, SubscriberCall{Method: method, QueueID: queueID, Num: num})
+	f := m.GetMsgFunc
+	m.mu.Unlock()
+	if f != nil {
+		return f(queueID, num)
+	}
+	return &umq.MessageInfo{}, nil
+}
+
+// Deliver 将msg交给最近一次订阅queueID时注册的回调，按订阅方法转换为Delivery或[]byte，
+// 返回回调通过channel确认的MsgId，未确认时返回空字符串
+func (m *Subscriber) Deliver(queueID string, msg umq.Message) string {
+	var sub *SubscriberCall
+	m.mu.Lock()
+	for i := len(m.calls) - 1; i >= 0; i-- {
+		if strings.HasPrefix(m.calls[i].Method, "Subscribe") && m.calls[i].QueueID == queueID {
+			call := m.calls[i]
+			sub = &call
+			break
+		}
+	}
+	m.mu.Unlock()
+	if sub == nil {
+		return ""
+	}
+	c := make(chan string, 1)
+	switch {
+	case sub.MsgHandler != nil:
+		sub.MsgHandler(c, msg)
+	case sub.DeliveryHandler != nil:
+		sub.DeliveryHandler(c, msg.Delivery())
+	case sub.BytesHandler != nil:
+		sub.BytesHandler(c, msg.MsgId, []byte(msg.MsgBody))
+	}
+	select {
+	case id := <-c:
+		return id
+	default:
+		return ""
+	}
+}
+
+// AckMsgCall 一次AckMsg或AckMsgContext调用
+type AckMsgCall struct {
+	QueueID string
+	MsgID   string
+}
+
+// Acker umq.Acker的mock实现
+type Acker struct {
+	mu    sync.Mutex
+	calls []AckMsgCall
+
+	// AckMsg及AckMsgContext共用
+	AckMsgFunc func(queueID, msgID string) error
+}
+
+// AckMsg 记录调用并返回AckMsgFunc的结果
+func (m *Acker) AckMsg(queueID, msgID string) error {
+	return m.AckMsgContext(context.Background(), queueID, msgID)
+}
+
+// AckMsgContext 记录调用并返回AckMsgFunc的结果
+func (m *Acker) AckMsgContext(ctx context.Context, queueID, msgID string) error {
+	m.mu.Lock()
+	m.calls = append(m.calls, AckMsgCall{QueueID: queueID, MsgID: msgID})
+	f := m.AckMsgFunc
+	m.mu.Unlock()
+	if f != nil {
+		return f(queueID, msgID)
+	}
+	return nil
+}
+
+// Calls 返回调用记录的副本
+func (m *Acker) Calls() []AckMsgCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]AckMsgCall(nil), m.calls...)
+}
+
+// QueueAdminCall QueueAdmin上的一次调用，Args按方法参数的顺序记录
+type QueueAdminCall struct {
+	Method string
+	Args   []interface{}
+}
+
+// QueueAdmin umq.QueueAdmin的mock实现
+type QueueAdmin struct {
+	mu    sync.Mutex
+	calls []QueueAdminCall
+
+	CreateQueueFunc func(projectID, couponID, remark, queueName, pushType, qos string) (interface{}, error)
+	DeleteQueueFunc func(queueID, projectID string) (interface{}, error)
+	ListQueueFunc   func(limit, offset int, projectID string) (interface{}, error)
+	CreateRoleFunc  func(queueID string, num int, role, projectID string) (interface{}, error)
+	DeleteRoleFunc  func(queueID, roleID, role string) (interface{}, error)
+}
+
+func (m *QueueAdmin) record(method string, args ...interface{}) {
+	m.mu.Lock()
+	m.calls = append(m.calls, QueueAdminCall{Method: method, Args: args})
+	m.mu.Unlock()
+}
+
+// Calls 返回调用记录的副本
+func (m *QueueAdmin) Calls() []QueueAdminCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]QueueAdminCall(nil), m.calls...)
+}
+
+// CreateQueue 记录调用并返回CreateQueueFunc的结果
+func (m *QueueAdmin) CreateQueue(projectID, couponID, remark, queueName, pushType, qos string) (interface{}, error) {
+	m.record("CreateQueue", projectID, couponID, remark, queueName, pushType, qos)
+	if m.CreateQueueFunc != nil {
+		return m.CreateQueueFunc(projectID, couponID, remark, queueName, pushType, qos)
+	}
+	return nil, nil
+}
+
+// DeleteQueue 记录调用并返回DeleteQueueFunc的结果
+func (m *QueueAdmin) DeleteQueue(queueID string, projectID string) (interface{}, error) {
+	m.record("DeleteQueue", queueID, projectID)
+	if m.DeleteQueueFunc != nil {
+		return m.DeleteQueueFunc(queueID, projectID)
+	}
+	return nil, nil
+}
+
+// ListQueue 记录调用并返回ListQueueFunc的结果
+func (m *QueueAdmin) ListQueue(limit int, offset int, projectID string) (interface{}, error) {
+	m.record("ListQueue", limit, offset, projectID)
+	if m.ListQueueFunc != nil {
+		return m.ListQueueFunc(limit, offset, projectID)
+	}
+	return nil, nil
+}
+
+// CreateRole 记录调用并返回CreateRoleFunc的结果
+func (m *QueueAdmin) CreateRole(queueID string, num int, role string, projectID string) (interface{}, error) {
+	m.record("CreateRole", queueID, num, role, projectID)
+	if m.CreateRoleFunc != nil {
+		return m.CreateRoleFunc(queueID, num, role, projectID)
+	}
+	return nil, nil
+}
+
+// DeleteRole 记录调用并返回DeleteRoleFunc的结果
+func (m *QueueAdmin) DeleteRole(queueID string, roleID string, role string) (interface{}, error) {
+	m.record("DeleteRole", queueID, roleID, role)
+	if m.DeleteRoleFunc != nil {
+		return m.DeleteRoleFunc(queueID, roleID, role)
+	}
+	return nil, nil
+}
+
+var (
+	_ umq.Publisher  = (*Publisher)(nil)
+	_ umq.Subscriber = (*Subscriber)(nil)
+	_ umq.Acker      = (*Acker)(nil)
+	_ umq.QueueAdmin = (*QueueAdmin)(nil)
+)
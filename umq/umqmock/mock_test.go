@@ -0,0 +1,140 @@
+package umqmock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+)
+
+func TestCallsAreRecordedConcurrently(t *testing.T) {
+	var (
+		p  Publisher
+		s  Subscriber
+		a  Acker
+		q  QueueAdmin
+		wg sync.WaitGroup
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.PublishMsg("q", "m")
+			s.GetMsg("q", 1)
+			a.AckMsg("q", "id")
+			q.ListQueue(10, 0, "p")
+			// Calls may run while other goroutines record
+			p.Calls()
+			s.Calls()
+		}()
+	}
+	wg.Wait()
+	if len(p.Calls()) != 10 || len(s.Calls()) != 10 || len(a.Calls()) != 10 || len(q.Calls()) != 10 {
+		t.Fatalf("calls = %d %d %d %d, want 10 each", len(p.Calls()), len(s.Calls()), len(a.Calls()), len(q.Calls()))
+	}
+}
+
+func TestCallsReturnsCopy(t *testing.T) {
+	var p Publisher
+	p.PublishMsg("q", "m")
+	calls := p.Calls()
+	calls[0].Envelope.Body = "changed"
+	if got := p.Calls()[0].Envelope.Body; got != "m" {
+		t.Fatalf("recorded content = %q after modifying the copy", got)
+	}
+}
+
+func TestSubscriberDeliver(t *testing.T) {
+	var s Subscriber
+	s.SubscribeQueue("q", func(c chan string, msg umq.Message) { c <- msg.MsgId })
+	s.UnSubscribe("other")
+	if id := s.Deliver("q", umq.Message{MsgId: "1"}); id != "1" {
+		t.Fatalf("Deliver = %q, want 1", id)
+	}
+	if id := s.Deliver("other", umq.Message{MsgId: "2"}); id != "" {
+		t.Fatalf("Deliver to a queue without subscription = %q", id)
+	}
+	calls := s.Calls()
+	if len(calls) != 2 || calls[0].Method != "SubscribeQueue" || calls[1].Method != "UnSubscribe" || calls[1].QueueID != "other" {
+		t.Fatalf("calls = %+v", calls)
+	}
+}
+
+func TestPublisherMethods(t *testing.T) {
+	p := &Publisher{}
+	var pub umq.Publisher = p
+	ctx := context.Background()
+	pub.PublishMsgContext(ctx, "q", "text")
+	pub.PublishMessage("q", umq.Envelope{Body: "env", IdempotencyKey: "k"})
+	pub.PublishBytesContext(ctx, "q", []byte{0xff})
+	res, err := pub.PublishMessageResult(ctx, "q", umq.Envelope{IdempotencyKey: "k2"})
+	if err != nil || res.Attempts != 1 || res.IdempotencyKey != "k2" {
+		t.Fatalf("PublishMessageResult = %+v, %v", res, err)
+	}
+	calls := p.Calls()
+	want := []PublishCall{
+		{Method: "PublishMsgContext", QueueID: "q", Envelope: umq.Envelope{Body: "text"}},
+		{Method: "PublishMessage", QueueID: "q", Envelope: umq.Envelope{Body: "env", IdempotencyKey: "k"}},
+		{Method: "PublishBytesContext", QueueID: "q", Envelope: umq.Envelope{Body: "\xff", Binary: true}},
+		{Method: "PublishMessageResult", QueueID: "q", Envelope: umq.Envelope{IdempotencyKey: "k2"}},
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %+v", calls)
+	}
+	for i := range want {
+		if calls[i].Method != want[i].Method || calls[i].QueueID != want[i].QueueID ||
+			calls[i].Envelope.Body != want[i].Envelope.Body || calls[i].Envelope.Binary != want[i].Envelope.Binary ||
+			calls[i].Envelope.IdempotencyKey != want[i].Envelope.IdempotencyKey {
+			t.Errorf("call %d = %+v, want %+v", i, calls[i], want[i])
+		}
+	}
+
+	failure := errors.New("boom")
+	p.PublishFunc = func(context.Context, string, umq.Envelope) (umq.PublishResult, error) {
+		return umq.PublishResult{}, failure
+	}
+	if err := pub.PublishBytes("q", nil); err != failure {
+		t.Fatalf("PublishBytes = %v, want PublishFunc's error", err)
+	}
+}
+
+func TestSubscriberDeliverConvertsMessage(t *testing.T) {
+	var s Subscriber
+	var sub umq.Subscriber = &s
+	var gotDelivery umq.Delivery
+	var gotBytes []byte
+	sub.SubscribeDelivery("d", func(c chan string, d umq.Delivery) {
+		gotDelivery = d
+		c <- d.MsgId
+	})
+	sub.SubscribeBytes("b", func(c chan string, msgID string, payload []byte) {
+		gotBytes = payload
+		c <- msgID
+	})
+	if id := s.Deliver("d", umq.Message{MsgId: "1", MsgBody: "plain"}); id != "1" {
+		t.Fatalf("Deliver to SubscribeDelivery = %q", id)
+	}
+	if gotDelivery.Body != "plain" || gotDelivery.Enveloped {
+		t.Errorf("Delivery = %+v", gotDelivery)
+	}
+	if id := s.Deliver("b", umq.Message{MsgId: "2", MsgBody: "raw"}); id != "2" || string(gotBytes) != "raw" {
+		t.Errorf("Deliver to SubscribeBytes = %q with payload %q", id, gotBytes)
+	}
+	sub.GetMsgContext(context.Background(), "d", 5)
+	calls := s.Calls()
+	if last := calls[len(calls)-1]; last.Method != "GetMsgContext" || last.Num != 5 {
+		t.Errorf("last call = %+v", last)
+	}
+}
+
+func TestAckerContext(t *testing.T) {
+	var a Acker
+	var acker umq.Acker = &a
+	acker.AckMsgContext(context.Background(), "q", "1")
+	acker.AckMsg("q", "2")
+	if calls := a.Calls(); len(calls) != 2 || calls[0].MsgID != "1" || calls[1].MsgID != "2" {
+		t.Fatalf("calls = %+v", calls)
+	}
+}
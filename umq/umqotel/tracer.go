@@ -0,0 +1,103 @@
+// Package umqotel 使用OpenTelemetry追踪umq SDK的调用
+//
+// 发布时会把W3C traceparent/tracestate写入消息的封装头，消费者处理消息时
+// 从中提取生产者的span，并以link的形式关联到处理消息的span上。
+//
+// 用法:
+//
+//	config.Tracer = umqotel.NewTracer(otel.GetTracerProvider())
+package umqotel
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+)
+
+// instrumentationName 作为TracerProvider中Tracer的名称
+const instrumentationName = "github.com/ucloud/umq-sdk-go/umq/umqotel"
+
+const messagingSystem = "umq"
+
+// Tracer 实现umq.Tracer
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+var _ umq.Tracer = (*Tracer)(nil)
+
+// NewTracer 使用tp创建Tracer，传播格式固定为W3C Trace Context
+func NewTracer(tp trace.TracerProvider) *Tracer {
+	return &Tracer{
+		tracer:     tp.Tracer(instrumentationName),
+		propagator: propagation.TraceContext{},
+	}
+}
+
+// StartPublish 开始producer span，并把trace上下文注入carrier
+func (t *Tracer) StartPublish(ctx context.Context, queueID string, carrier map[string]string) (context.Context, umq.SpanEnd) {
+	ctx, span := t.tracer.Start(ctx, queueID+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(queueAttributes(queueID, "publish")...))
+	t.propagator.Inject(ctx, propagation.MapCarrier(carrier))
+	return ctx, endSpan(span)
+}
+
+// StartGetMsg 开始一次拉取消息的span
+func (t *Tracer) StartGetMsg(ctx context.Context, queueID string, num int) (context.Context, umq.SpanEnd) {
+	attrs := append(queueAttributes(queueID, "receive"), attribute.Int("messaging.batch.message_count", num))
+	ctx, span := t.tracer.Start(ctx, queueID+" receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attrs...))
+	return ctx, endSpan(span)
+}
+
+// StartAck 开始一次ack的span
+func (t *Tracer) StartAck(ctx context.Context, queueID, msgID string) (context.Context, umq.SpanEnd) {
+	attrs := append(queueAttributes(queueID, "settle"), attribute.String("messaging.message.id", msgID))
+	ctx, span := t.tracer.Start(ctx, queueID+" ack",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+	return ctx, endSpan(span)
+}
+
+// StartHandler 开始consumer span，carrier中携带生产者span时以link关联
+func (t *Tracer) StartHandler(ctx context.Context, queueID string, msg umq.Message, carrier map[string]string) (context.Context, umq.SpanEnd) {
+	attrs := append(queueAttributes(queueID, "process"), attribute.String("messaging.message.id", msg.MsgId))
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attrs...),
+	}
+	if carrier != nil {
+		producer := trace.SpanContextFromContext(t.propagator.Extract(ctx, propagation.MapCarrier(carrier)))
+		if producer.IsValid() {
+			opts = append(opts, trace.WithLinks(trace.Link{SpanContext: producer}))
+		}
+	}
+	ctx, span := t.tracer.Start(ctx, queueID+" process", opts...)
+	return ctx, endSpan(span)
+}
+
+func queueAttributes(queueID, operation string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("messaging.system", messagingSystem),
+		attribute.String("messaging.destination.name", queueID),
+		attribute.String("messaging.operation.name", operation),
+	}
+}
+
+func endSpan(span trace.Span) umq.SpanEnd {
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
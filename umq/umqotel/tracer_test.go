@@ -0,0 +1,98 @@
+package umqotel_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+	"github.com/ucloud/umq-sdk-go/umq/umqotel"
+	"github.com/ucloud/umq-sdk-go/umq/umqtest"
+)
+
+func TestConsumerSpanLinksProducerSpan(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	defer tp.Shutdown(context.Background())
+
+	srv := umqtest.NewServer()
+	defer srv.Close()
+	queueID := srv.CreateQueue("test", "Direct")
+	producerID, producerToken := srv.CreateRole(queueID, "Pub")
+	consumerID, consumerToken := srv.CreateRole(queueID, "Sub")
+	config := srv.Config()
+	config.Tracer = umqotel.NewTracer(tp)
+	client, err := umq.CreateClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 发布时的父span，producer span应属于同一个trace
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	err = client.NewProducer(producerID, producerToken).PublishMsgContext(ctx, queueID, "hello")
+	parent.End()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	consumer := client.NewConsumer(consumerID, consumerToken)
+	type handled struct {
+		span trace.SpanContext
+		body string
+	}
+	got := make(chan handled, 1)
+	go consumer.SubscribeQueue(queueID, func(c chan string, msg umq.Message) {
+		got <- handled{trace.SpanContextFromContext(msg.Context()), msg.MsgBody}
+		c <- msg.MsgId
+	})
+	defer consumer.UnSubscribe(queueID)
+	var h handled
+	select {
+	case h = <-got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+	if h.body != "hello" {
+		t.Errorf("handler got %q, the traceparent envelope leaked into the body", h.body)
+	}
+
+	var publish, process sdktrace.ReadOnlySpan
+	deadline := time.Now().Add(5 * time.Second)
+	for process == nil {
+		for _, s := range sr.Ended() {
+			switch s.Name() {
+			case queueID + " publish":
+				publish = s
+			case queueID + " process":
+				process = s
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("consumer span not recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if publish == nil {
+		t.Fatal("producer span not recorded")
+	}
+	if publish.SpanKind() != trace.SpanKindProducer || process.SpanKind() != trace.SpanKindConsumer {
+		t.Errorf("span kinds = %v, %v", publish.SpanKind(), process.SpanKind())
+	}
+	if publish.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("producer span is not a child of the publishing context")
+	}
+	links := process.Links()
+	if len(links) != 1 {
+		t.Fatalf("consumer span has %d links, want 1", len(links))
+	}
+	if sc := links[0].SpanContext; sc.TraceID() != publish.SpanContext().TraceID() || sc.SpanID() != publish.SpanContext().SpanID() {
+		t.Errorf("consumer span links %v, want producer span %v", sc, publish.SpanContext())
+	}
+	if h.span.SpanID() != process.SpanContext().SpanID() {
+		t.Error("Message.Context does not carry the consumer span")
+	}
+}
@@ -0,0 +1,143 @@
+// Package umqprom 使用Prometheus采集umq SDK的指标
+//
+// 用法:
+//
+//	collector := umqprom.NewCollector("myapp")
+//	prometheus.MustRegister(collector)
+//	config.Metrics = collector
+package umqprom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+)
+
+// Collector 同时实现umq.Metrics及prometheus.Collector
+type Collector struct {
+	publishDuration *prometheus.HistogramVec
+	publishTotal    *prometheus.CounterVec
+	received        *prometheus.CounterVec
+	handlerDuration *prometheus.HistogramVec
+	ackDuration     *prometheus.HistogramVec
+	ackTotal        *prometheus.CounterVec
+	reconnects      *prometheus.CounterVec
+	connected       *prometheus.GaugeVec
+	inFlight        *prometheus.GaugeVec
+}
+
+var _ umq.Metrics = (*Collector)(nil)
+var _ prometheus.Collector = (*Collector)(nil)
+
+// NewCollector 创建Collector，所有指标以namespace_umq_为前缀
+func NewCollector(namespace string) *Collector {
+	return &Collector{
+		publishDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "umq", Name: "publish_duration_seconds",
+			Help: "Latency of PublishMsg calls.",
+		}, []string{"queue"}),
+		publishTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "umq", Name: "publish_total",
+			Help: "PublishMsg calls by result.",
+		}, []string{"queue", "result"}),
+		received: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "umq", Name: "messages_received_total",
+			Help: "Messages received by subscriptions.",
+		}, []string{"queue"}),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "umq", Name: "handler_duration_seconds",
+			Help: "Time spent in MsgHandler calls.",
+		}, []string{"queue"}),
+		ackDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "umq", Name: "ack_duration_seconds",
+			Help: "Latency of AckMsg calls.",
+		}, []string{"queue"}),
+		ackTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "umq", Name: "ack_total",
+			Help: "AckMsg calls by result.",
+		}, []string{"queue", "result"}),
+		reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "umq", Name: "reconnects_total",
+			Help: "Successful subscription reconnects.",
+		}, []string{"queue"}),
+		connected: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Subsystem: "umq", Name: "connected",
+			Help: "Whether the subscription websocket is connected (1) or not (0).",
+		}, []string{"queue"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Subsystem: "umq", Name: "in_flight_messages",
+			Help: "Messages received but not yet acked.",
+		}, []string{"queue"}),
+	}
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.publishDuration, c.publishTotal, c.received, c.handlerDuration,
+		c.ackDuration, c.ackTotal, c.reconnects, c.connected, c.inFlight,
+	}
+}
+
+// Describe 实现prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.collectors() {
+		m.Describe(ch)
+	}
+}
+
+// Collect 实现prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c.collectors() {
+		m.Collect(ch)
+	}
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// PublishDone 实现umq.Metrics
+func (c *Collector) PublishDone(queueID string, duration time.Duration, err error) {
+	c.publishDuration.WithLabelValues(queueID).Observe(duration.Seconds())
+	c.publishTotal.WithLabelValues(queueID, result(err)).Inc()
+}
+
+// MessageReceived 实现umq.Metrics
+func (c *Collector) MessageReceived(queueID string) {
+	c.received.WithLabelValues(queueID).Inc()
+}
+
+// HandlerDone 实现umq.Metrics
+func (c *Collector) HandlerDone(queueID string, duration time.Duration) {
+	c.handlerDuration.WithLabelValues(queueID).Observe(duration.Seconds())
+}
+
+// AckDone 实现umq.Metrics
+func (c *Collector) AckDone(queueID string, duration time.Duration, err error) {
+	c.ackDuration.WithLabelValues(queueID).Observe(duration.Seconds())
+	c.ackTotal.WithLabelValues(queueID, result(err)).Inc()
+}
+
+// Reconnected 实现umq.Metrics
+func (c *Collector) Reconnected(queueID string) {
+	c.reconnects.WithLabelValues(queueID).Inc()
+}
+
+// ConnectionState 实现umq.Metrics
+func (c *Collector) ConnectionState(queueID string, connected bool) {
+	v := 0.0
+	if connected {
+		v = 1
+	}
+	c.connected.WithLabelValues(queueID).Set(v)
+}
+
+// InFlight 实现umq.Metrics
+func (c *Collector) InFlight(queueID string, delta int) {
+	c.inFlight.WithLabelValues(queueID).Add(float64(delta))
+}
@@ -0,0 +1,129 @@
+package umqprom
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+	"github.com/ucloud/umq-sdk-go/umq/umqtest"
+)
+
+// sampleCount 返回直方图中一个序列的样本数
+func sampleCount(t *testing.T, o prometheus.Observer) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := o.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestCollectorSeries(t *testing.T) {
+	c := NewCollector("test")
+	failure := errors.New("failed")
+
+	c.PublishDone("q", time.Millisecond, nil)
+	c.PublishDone("q", time.Millisecond, failure)
+	c.PublishDone("q", time.Millisecond, nil)
+	c.MessageReceived("q")
+	c.HandlerDone("q", time.Millisecond)
+	c.AckDone("q", time.Millisecond, failure)
+	c.Reconnected("q")
+	c.ConnectionState("q", true)
+	c.InFlight("q", 3)
+	c.InFlight("q", -1)
+
+	counters := []struct {
+		name string
+		got  prometheus.Collector
+		want float64
+	}{
+		{"publish ok", c.publishTotal.WithLabelValues("q", "ok"), 2},
+		{"publish error", c.publishTotal.WithLabelValues("q", "error"), 1},
+		{"received", c.received.WithLabelValues("q"), 1},
+		{"ack ok", c.ackTotal.WithLabelValues("q", "ok"), 0},
+		{"ack error", c.ackTotal.WithLabelValues("q", "error"), 1},
+		{"reconnects", c.reconnects.WithLabelValues("q"), 1},
+		{"connected", c.connected.WithLabelValues("q"), 1},
+		{"in flight", c.inFlight.WithLabelValues("q"), 2},
+	}
+	for _, tt := range counters {
+		if got := testutil.ToFloat64(tt.got); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	histograms := []struct {
+		name string
+		got  prometheus.Observer
+		want uint64
+	}{
+		{"publish duration", c.publishDuration.WithLabelValues("q"), 3},
+		{"handler duration", c.handlerDuration.WithLabelValues("q"), 1},
+		{"ack duration", c.ackDuration.WithLabelValues("q"), 1},
+	}
+	for _, tt := range histograms {
+		if got := sampleCount(t, tt.got); got != tt.want {
+			t.Errorf("%s samples = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	c.ConnectionState("q", false)
+	if got := testutil.ToFloat64(c.connected.WithLabelValues("q")); got != 0 {
+		t.Errorf("connected after disconnect = %v", got)
+	}
+	// 9个指标各一个序列，publish_total及ack_total各两个
+	if n := testutil.CollectAndCount(c); n != 11 {
+		t.Errorf("collected %d series, want 11", n)
+	}
+	if problems, err := testutil.CollectAndLint(c); err != nil || len(problems) != 0 {
+		t.Errorf("lint: %v %v", problems, err)
+	}
+}
+
+func TestCollectorWithClient(t *testing.T) {
+	srv := umqtest.NewServer()
+	defer srv.Close()
+	queueID := srv.CreateQueue("test", "Direct")
+	producerID, producerToken := srv.CreateRole(queueID, "Pub")
+	consumerID, consumerToken := srv.CreateRole(queueID, "Sub")
+	c := NewCollector("test")
+	config := srv.Config()
+	config.Metrics = c
+	client, err := umq.CreateClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.NewProducer(producerID, producerToken).PublishMsg(queueID, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	consumer := client.NewConsumer(consumerID, consumerToken)
+	go consumer.SubscribeQueue(queueID, func(ch chan string, msg umq.Message) { ch <- msg.MsgId })
+	defer consumer.UnSubscribe(queueID)
+
+	checks := []struct {
+		name string
+		got  prometheus.Collector
+	}{
+		{"publish_total", c.publishTotal.WithLabelValues(queueID, "ok")},
+		{"messages_received_total", c.received.WithLabelValues(queueID)},
+		{"ack_total", c.ackTotal.WithLabelValues(queueID, "ok")},
+		{"connected", c.connected.WithLabelValues(queueID)},
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for _, check := range checks {
+		for testutil.ToFloat64(check.got) != 1 {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s = %v, want 1", check.name, testutil.ToFloat64(check.got))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if got := testutil.ToFloat64(c.inFlight.WithLabelValues(queueID)); got != 0 {
+		t.Errorf("in_flight_messages = %v after ack, want 0", got)
+	}
+}
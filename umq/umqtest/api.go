@@ -0,0 +1,148 @@
+package umqtest
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// serveAPI 处理管理API
+func (s *Server) serveAPI(action string, params url.Values) response {
+	if !s.checkSignature(params) {
+		return reply(action, retCodeAuthFailed, "Signature verification failed")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch action {
+	case "UmqCreateQueue":
+		pushType := params.Get("PushType")
+		if pushType != "Direct" && pushType != "Fanout" {
+			return reply(action, retCodeInvalidParam, "Invalid PushType")
+		}
+		q := s.createQueue(params.Get("QueueName"), pushType)
+		res := reply(action, retCodeOK, "")
+		res["DataSet"] = map[string]interface{}{"QueueId": q.id}
+		return res
+
+	case "UmqDeleteQueue":
+		q, ok := s.queues[params.Get("QueueId")]
+		if !ok {
+			return reply(action, retCodeNotFound, "Queue not found")
+		}
+		delete(s.queues, q.id)
+		for sess := range s.sessions {
+			if sess.queueID == q.id {
+				sess.conn.Close()
+			}
+		}
+		return reply(action, retCodeOK, "")
+
+	case "UmqGetQueue":
+		ids := make([]string, 0, len(s.queues))
+		for id := range s.queues {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		dataSet := make([]interface{}, 0)
+		for _, id := range page(ids, params) {
+			q := s.queues[id]
+			dataSet = append(dataSet, map[string]interface{}{
+				"QueueId":    q.id,
+				"QueueName":  q.name,
+				"PushType":   q.pushType,
+				"MsgTtl":     3600,
+				"CreateTime": q.createTime,
+				"HttpAddr":   s.URL + "/",
+			})
+		}
+		res := reply(action, retCodeOK, "")
+		res["DataSet"] = dataSet
+		return res
+
+	case "UmqCreateRole":
+		q, ok := s.queues[params.Get("QueueId")]
+		if !ok {
+			return reply(action, retCodeNotFound, "Queue not found")
+		}
+		roleName := params.Get("Role")
+		if roleName != "Pub" && roleName != "Sub" {
+			return reply(action, retCodeInvalidParam, "Invalid Role")
+		}
+		num, err := strconv.Atoi(params.Get("Num"))
+		if err != nil || num <= 0 {
+			return reply(action, retCodeInvalidParam, "Invalid Num")
+		}
+		dataSet := make([]interface{}, 0, num)
+		for i := 0; i < num; i++ {
+			dataSet = append(dataSet, roleData(s.createRole(q, roleName)))
+		}
+		res := reply(action, retCodeOK, "")
+		res["DataSet"] = dataSet
+		return res
+
+	case "UmqDeleteRole":
+		q, ok := s.queues[params.Get("QueueId")]
+		if !ok {
+			return reply(action, retCodeNotFound, "Queue not found")
+		}
+		roles := q.subs
+		if params.Get("Role") == "Pub" {
+			roles = q.pubs
+		}
+		id := params.Get("RoleId")
+		if _, ok := roles[id]; !ok {
+			return reply(action, retCodeNotFound, "Role not found")
+		}
+		delete(roles, id)
+		delete(q.fanout, id)
+		return reply(action, retCodeOK, "")
+
+	case "UmqGetRole":
+		q, ok := s.queues[params.Get("QueueId")]
+		if !ok {
+			return reply(action, retCodeNotFound, "Queue not found")
+		}
+		roles := q.subs
+		if params.Get("Role") == "Pub" {
+			roles = q.pubs
+		}
+		ids := make([]string, 0, len(roles))
+		for id := range roles {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		dataSet := make([]interface{}, 0)
+		for _, id := range page(ids, params) {
+			dataSet = append(dataSet, roleData(roles[id]))
+		}
+		res := reply(action, retCodeOK, "")
+		res["DataSet"] = dataSet
+		return res
+	}
+	return reply(action, retCodeInvalidParam, "Unknown action")
+}
+
+func roleData(r *role) map[string]interface{} {
+	return map[string]interface{}{
+		"Id":         r.id,
+		"Token":      r.token,
+		"CreateTime": r.createTime,
+	}
+}
+
+// page 按Limit及Offset参数截取列表
+func page(ids []string, params url.Values) []string {
+	offset, _ := strconv.Atoi(params.Get("Offset"))
+	limit, err := strconv.Atoi(params.Get("Limit"))
+	if err != nil || limit <= 0 {
+		limit = len(ids)
+	}
+	if offset < 0 || offset >= len(ids) {
+		return nil
+	}
+	ids = ids[offset:]
+	if limit < len(ids) {
+		ids = ids[:limit]
+	}
+	return ids
+}
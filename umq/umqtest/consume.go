@@ -0,0 +1,145 @@
+package umqtest
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+	"github.com/ucloud/umq-sdk-go/umq/websocket"
+)
+
+// session 一个通过websocket订阅队列的消费者连接
+type session struct {
+	conn       *websocket.Conn
+	remoteAddr string
+	queueID    string
+	consumerID string
+	done       chan struct{}
+}
+
+type consumeReq struct {
+	Action string
+	Data   struct {
+		OrganizationId uint64
+		QueueId        string
+		ConsumerId     string
+		ConsumerToken  string
+	}
+}
+
+type pushMsg struct {
+	Action  string
+	RetCode int
+	Data    umq.Message
+}
+
+// serveConsume 处理websocket上的ConsumeMsg订阅，并持续推送消息
+func (s *Server) serveConsume(conn *websocket.Conn) {
+	var req consumeReq
+	if err := websocket.JSON.Receive(conn, &req); err != nil {
+		return
+	}
+	if f := s.fault("ConsumeMsg"); f != nil {
+		if f.Delay > 0 {
+			time.Sleep(f.Delay)
+		}
+		if f.Drop {
+			return
+		}
+		if f.RetCode != 0 {
+			websocket.JSON.Send(conn, reply("ConsumeMsg", f.RetCode, f.Message))
+			conn.CloseWithReason(websocket.CloseStatusPolicyViolation, f.Message)
+			return
+		}
+	}
+
+	params := url.Values{}
+	params.Set("OrganizationId", strconv.FormatUint(req.Data.OrganizationId, 10))
+	params.Set("QueueId", req.Data.QueueId)
+	params.Set("ConsumerId", req.Data.ConsumerId)
+	params.Set("ConsumerToken", req.Data.ConsumerToken)
+
+	sess := &session{
+		conn:       conn,
+		remoteAddr: conn.Request().RemoteAddr,
+		queueID:    req.Data.QueueId,
+		consumerID: req.Data.ConsumerId,
+		done:       make(chan struct{}),
+	}
+	s.mu.Lock()
+	_, code, msg := s.lookupRole(params, "Sub", "ConsumerId", "ConsumerToken", true)
+	if code == retCodeOK {
+		s.sessions[sess] = struct{}{}
+	}
+	s.mu.Unlock()
+	if code != retCodeOK {
+		websocket.JSON.Send(conn, reply("ConsumeMsg", code, msg))
+		conn.CloseWithReason(websocket.CloseStatusPolicyViolation, msg)
+		return
+	}
+	defer s.endSession(sess)
+	if err := websocket.JSON.Send(conn, reply("ConsumeMsg", retCodeOK, "")); err != nil {
+		return
+	}
+
+	// 客户端不会主动发送数据，读到错误即认为连接已断开
+	go func() {
+		var discard []byte
+		for {
+			if err := websocket.Message.Receive(conn, &discard); err != nil {
+				close(sess.done)
+				return
+			}
+		}
+	}()
+
+	for {
+		s.mu.Lock()
+		var m *message
+		q, ok := s.queues[sess.queueID]
+		if ok {
+			m = q.group(sess.consumerID).take(sess, time.Now().Add(s.ackTimeout))
+			if m != nil {
+				q.stats.Delivered++
+			}
+		}
+		notify := s.notify
+		s.mu.Unlock()
+		if !ok {
+			return
+		}
+		if m != nil {
+			buf, _ := json.Marshal(pushMsg{Action: "PushMsg", Data: umq.Message{MsgId: m.id, MsgBody: m.body}})
+			if err := websocket.Message.Send(conn, string(buf)); err != nil {
+				return
+			}
+			continue
+		}
+		select {
+		case <-notify:
+		case <-sess.done:
+			return
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// endSession 移除连接，并将该连接上未ack的消息放回队列
+func (s *Server) endSession(sess *session) {
+	sess.conn.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sess)
+	q, ok := s.queues[sess.queueID]
+	if !ok {
+		return
+	}
+	n := q.group(sess.consumerID).requeue(func(m *inflightMsg) bool { return m.owner == sess })
+	if n > 0 {
+		q.stats.Redelivered += n
+		s.broadcast()
+	}
+}
@@ -0,0 +1,129 @@
+package umqtest
+
+import (
+	"time"
+)
+
+type message struct {
+	id   string
+	body string
+}
+
+type inflightMsg struct {
+	msg      *message
+	deadline time.Time
+	owner    *session // 通过websocket投递时为对应的连接，GetMsg投递时为nil
+}
+
+// group 一组共享消息的消费者，Direct队列所有消费者共享一个group，Fanout队列每个消费者一个
+type group struct {
+	ready    []*message
+	inflight map[string]*inflightMsg
+}
+
+func newGroup() *group {
+	return &group{inflight: make(map[string]*inflightMsg)}
+}
+
+// take 取出一条待投递的消息并标记为未确认
+func (g *group) take(owner *session, deadline time.Time) *message {
+	if len(g.ready) == 0 {
+		return nil
+	}
+	msg := g.ready[0]
+	g.ready = g.ready[1:]
+	g.inflight[msg.id] = &inflightMsg{msg: msg, deadline: deadline, owner: owner}
+	return msg
+}
+
+// requeue 将满足条件的未确认消息放回队首，返回放回的条数
+func (g *group) requeue(match func(*inflightMsg) bool) int {
+	var back []*message
+	for id, m := range g.inflight {
+		if match(m) {
+			back = append(back, m.msg)
+			delete(g.inflight, id)
+		}
+	}
+	if len(back) > 0 {
+		g.ready = append(back, g.ready...)
+	}
+	return len(back)
+}
+
+type role struct {
+	id         string
+	token      string
+	createTime int64
+}
+
+// queue 内存中的队列
+type queue struct {
+	id         string
+	name       string
+	pushType   string
+	createTime int64
+
+	pubs   map[string]*role
+	subs   map[string]*role
+	direct *group
+	fanout map[string]*group
+	stats  QueueStats
+}
+
+// QueueStats 队列的统计信息
+type QueueStats struct {
+	Published   int
+	Delivered   int
+	Redelivered int
+	Acked       int
+}
+
+func newQueue(id, name, pushType string) *queue {
+	return &queue{
+		id:         id,
+		name:       name,
+		pushType:   pushType,
+		createTime: time.Now().Unix(),
+		pubs:       make(map[string]*role),
+		subs:       make(map[string]*role),
+		direct:     newGroup(),
+		fanout:     make(map[string]*group),
+	}
+}
+
+// group 返回consumerID对应的消息组
+func (q *queue) group(consumerID string) *group {
+	if q.pushType != "Fanout" {
+		return q.direct
+	}
+	g, ok := q.fanout[consumerID]
+	if !ok {
+		g = newGroup()
+		q.fanout[consumerID] = g
+	}
+	return g
+}
+
+func (q *queue) publish(msg *message) {
+	q.stats.Published++
+	if q.pushType != "Fanout" {
+		q.direct.ready = append(q.direct.ready, msg)
+		return
+	}
+	for id := range q.subs {
+		g := q.group(id)
+		g.ready = append(g.ready, msg)
+	}
+}
+
+func (q *queue) groups() []*group {
+	if q.pushType != "Fanout" {
+		return []*group{q.direct}
+	}
+	list := make([]*group, 0, len(q.fanout))
+	for _, g := range q.fanout {
+		list = append(list, g)
+	}
+	return list
+}
@@ -0,0 +1,561 @@
+// Package umqtest 提供一个进程内的UMQ模拟服务，用于在没有UCloud账户的情况下测试基于SDK的代码
+//
+// 典型用法:
+//
+//	srv := umqtest.NewServer()
+//	defer srv.Close()
+//	queueID := srv.CreateQueue("test", "Direct")
+//	pubID, pubToken := srv.CreateRole(queueID, "Pub")
+//	client, err := umq.CreateClient(srv.Config())
+package umqtest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ucloud/umq-sdk-go/umq"
+	"github.com/ucloud/umq-sdk-go/umq/websocket"
+)
+
+const (
+	retCodeOK           = 0
+	retCodeAuthFailed   = 171
+	retCodeInvalidParam = 230
+	retCodeNotFound     = 404
+)
+
+// DefaultAckTimeout 默认的消息确认超时时间，超时未ack的消息会被重新投递
+const DefaultAckTimeout = 30 * time.Second
+
+// Fault 注入到某个Action上的故障
+type Fault struct {
+	// 处理请求前的延迟
+	Delay time.Duration
+	// 非0时不处理请求，直接返回该RetCode
+	RetCode int
+	// 返回RetCode时附带的错误信息
+	Message string
+	// 为true时直接断开连接，不返回任何内容
+	Drop bool
+	// 生效次数，0表示一直生效
+	Times int
+}
+
+// Server 模拟的UMQ服务，同时提供数据面 (PublishMsg/GetMsg/AckMsg/ConsumeMsg)
+// 及管理API (UmqCreateQueue等)
+type Server struct {
+	// 服务地址，例如 http://127.0.0.1:12345
+	URL string
+
+	PublicKey      string
+	PrivateKey     string
+	Account        string
+	ProjectID      string
+	OrganizationID int
+
+	srv      *httptest.Server
+	conns    *connTracker
+	mu       sync.Mutex
+	queues   map[string]*queue
+	faults   map[string]*Fault
+	sessions map[*session]struct{}
+	notify   chan struct{}
+	closed   chan struct{}
+	seq      int
+
+	ackTimeout   time.Duration
+	maxURLLength int
+	disablePost  bool
+}
+
+// NewServer 启动一个模拟服务
+func NewServer() *Server {
+	s := &Server{
+		PublicKey:      "umqtest-public-key",
+		PrivateKey:     "umqtest-private-key",
+		Account:        "umqtest@example.com",
+		ProjectID:      "org-umqtest",
+		OrganizationID: 10000,
+
+		queues:     make(map[string]*queue),
+		faults:     make(map[string]*Fault),
+		sessions:   make(map[*session]struct{}),
+		notify:     make(chan struct{}),
+		closed:     make(chan struct{}),
+		ackTimeout: DefaultAckTimeout,
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/ws", websocket.Server{Handler: s.serveConsume})
+	mux.HandleFunc("/", s.serveHTTP)
+	s.srv = httptest.NewUnstartedServer(mux)
+	s.conns = &connTracker{Listener: s.srv.Listener, conns: make(map[string]net.Conn)}
+	s.srv.Listener = s.conns
+	s.srv.Start()
+	s.URL = s.srv.URL
+	go s.redeliverLoop()
+	return s
+}
+
+// Close 关闭服务及所有websocket连接
+func (s *Server) Close() {
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+		s.mu.Unlock()
+		return
+	default:
+	}
+	close(s.closed)
+	s.mu.Unlock()
+	s.conns.closeAll()
+	s.srv.Close()
+}
+
+// Config 返回指向该服务的客户端配置
+func (s *Server) Config() umq.UmqConfig {
+	return umq.UmqConfig{
+		HTTPURL:    s.URL + "/",
+		APIURL:     s.URL + "/",
+		Region:     "cn-test",
+		Account:    s.Account,
+		ProjectID:  s.ProjectID,
+		PublicKey:  s.PublicKey,
+		PrivateKey: s.PrivateKey,
+	}
+}
+
+// SetAckTimeout 设置消息确认超时时间
+func (s *Server) SetAckTimeout(d time.Duration) {
+	s.mu.Lock()
+	s.ackTimeout = d
+	s.mu.Unlock()
+}
+
+// SetMaxURLLength 设置服务端接受的URL最大长度，超过时返回HTTP 414，0表示不限制
+func (s *Server) SetMaxURLLength(n int) {
+	s.mu.Lock()
+	s.maxURLLength = n
+	s.mu.Unlock()
+}
+
+// DisablePost 为true时拒绝POST请求（HTTP 405），模拟只支持GET的服务端
+func (s *Server) DisablePost(disable bool) {
+	s.mu.Lock()
+	s.disablePost = disable
+	s.mu.Unlock()
+}
+
+// CreateQueue 直接创建一个队列，返回队列ID
+func (s *Server) CreateQueue(name, pushType string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createQueue(name, pushType).id
+}
+
+// CreateRole 直接为队列创建一个角色，role为Pub或Sub，返回角色ID及Token
+func (s *Server) CreateRole(queueID, role string) (id, token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.queues[queueID]
+	if !ok {
+		panic("umqtest: no such queue " + queueID)
+	}
+	r := s.createRole(q, role)
+	return r.id, r.token
+}
+
+// Stats 返回队列的统计信息
+func (s *Server) Stats(queueID string) QueueStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q, ok := s.queues[queueID]; ok {
+		return q.stats
+	}
+	return QueueStats{}
+}
+
+// Pending 返回consumerID尚未确认的消息数，包括未投递及已投递未ack的消息
+func (s *Server) Pending(queueID, consumerID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.queues[queueID]
+	if !ok {
+		return 0
+	}
+	g := q.group(consumerID)
+	return len(g.ready) + len(g.inflight)
+}
+
+// InjectFault 在action上注入故障，action为请求的Action，websocket订阅为ConsumeMsg
+func (s *Server) InjectFault(action string, f Fault) {
+	s.mu.Lock()
+	s.faults[action] = &f
+	s.mu.Unlock()
+}
+
+// ClearFaults 清除所有注入的故障
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	s.faults = make(map[string]*Fault)
+	s.mu.Unlock()
+}
+
+// DisconnectConsumers 直接断开queueID上所有websocket连接，queueID为空时断开全部连接
+func (s *Server) DisconnectConsumers(queueID string) {
+	for _, sess := range s.sessionsOf(queueID) {
+		s.conns.close(sess.remoteAddr)
+	}
+}
+
+// CloseConsumers 以指定的关闭码及原因关闭queueID上所有websocket连接
+func (s *Server) CloseConsumers(queueID string, code int, reason string) {
+	for _, sess := range s.sessionsOf(queueID) {
+		sess.conn.CloseWithReason(code, reason)
+	}
+}
+
+func (s *Server) sessionsOf(queueID string) []*session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*session
+	for sess := range s.sessions {
+		if queueID == "" || sess.queueID == queueID {
+			list = append(list, sess)
+		}
+	}
+	return list
+}
+
+// fault 返回action上生效的故障，并消耗一次生效次数
+func (s *Server) fault(action string) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.faults[action]
+	if !ok {
+		return nil
+	}
+	if f.Times > 0 {
+		f.Times--
+		if f.Times == 0 {
+			delete(s.faults, action)
+		}
+	}
+	copied := *f
+	return &copied
+}
+
+func (s *Server) nextID(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s-%d", prefix, s.seq)
+}
+
+// broadcast 唤醒所有等待消息的连接，调用时需持有s.mu
+func (s *Server) broadcast() {
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+func (s *Server) createQueue(name, pushType string) *queue {
+	q := newQueue(s.nextID("umq"), name, pushType)
+	s.queues[q.id] = q
+	return q
+}
+
+func (s *Server) createRole(q *queue, roleName string) *role {
+	r := &role{createTime: time.Now().Unix()}
+	if roleName == "Pub" {
+		r.id = s.nextID("pub")
+		q.pubs[r.id] = r
+	} else {
+		r.id = s.nextID("sub")
+		q.subs[r.id] = r
+	}
+	r.token = s.nextID("token")
+	return r
+}
+
+// redeliverLoop 定期将超时未ack的消息放回队列
+func (s *Server) redeliverLoop() {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closed:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			n := 0
+			for _, q := range s.queues {
+				for _, g := range q.groups() {
+					c := g.requeue(func(m *inflightMsg) bool { return now.After(m.deadline) })
+					q.stats.Redelivered += c
+					n += c
+				}
+			}
+			if n > 0 {
+				s.broadcast()
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+type response map[string]interface{}
+
+func reply(action string, retCode int, message string) response {
+	res := response{"Action": action + "Response", "RetCode": retCode}
+	if message != "" {
+		res["Message"] = message
+	}
+	return res
+}
+
+// requestParams 读取GET查询串或POST的JSON请求体中的参数，失败时返回HTTP状态码
+func (s *Server) requestParams(r *http.Request) (url.Values, int) {
+	s.mu.Lock()
+	maxURLLength, disablePost := s.maxURLLength, s.disablePost
+	s.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		if maxURLLength > 0 && len(r.RequestURI) > maxURLLength {
+			return nil, http.StatusRequestURITooLong
+		}
+		return r.URL.Query(), 0
+	case http.MethodPost:
+		if disablePost {
+			return nil, http.StatusMethodNotAllowed
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return nil, http.StatusBadRequest
+		}
+		params := make(url.Values, len(body))
+		for k, v := range body {
+			params.Set(k, v)
+		}
+		return params, 0
+	}
+	return nil, http.StatusMethodNotAllowed
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	params, status := s.requestParams(r)
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	action := params.Get("Action")
+	if f := s.fault(action); f != nil {
+		if f.Delay > 0 {
+			time.Sleep(f.Delay)
+		}
+		if f.Drop {
+			if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+				conn.Close()
+			}
+			return
+		}
+		if f.RetCode != 0 {
+			writeJSON(w, reply(action, f.RetCode, f.Message))
+			return
+		}
+	}
+
+	var res response
+	switch action {
+	case "GetOrganizationId":
+		res = s.getOrganizationID(params)
+	case "PublishMsg":
+		res = s.publishMsg(params)
+	case "GetMsg":
+		res = s.getMsg(params)
+	case "AckMsg":
+		res = s.ackMsg(params)
+	case "UmqCreateQueue", "UmqDeleteQueue", "UmqGetQueue", "UmqCreateRole", "UmqDeleteRole", "UmqGetRole":
+		res = s.serveAPI(action, params)
+	default:
+		res = reply(action, retCodeInvalidParam, "Unknown action")
+	}
+	writeJSON(w, res)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// checkSignature 按SDK的签名算法校验公钥及签名
+func (s *Server) checkSignature(params url.Values) bool {
+	if params.Get("PublicKey") != s.PublicKey {
+		return false
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k != "Signature" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var source string
+	for _, k := range keys {
+		source += k + params.Get(k)
+	}
+	source += s.PrivateKey
+	h := sha1.New()
+	h.Write([]byte(source))
+	return hex.EncodeToString(h.Sum(nil)) == params.Get("Signature")
+}
+
+func (s *Server) getOrganizationID(params url.Values) response {
+	if !s.checkSignature(params) {
+		return reply("GetOrganizationId", retCodeAuthFailed, "Signature verification failed")
+	}
+	if params.Get("UserEmail") != s.Account || params.Get("OrganizationAlias") != s.ProjectID {
+		return reply("GetOrganizationId", retCodeNotFound, "Project not found")
+	}
+	res := reply("GetOrganizationId", retCodeOK, "")
+	res["Data"] = s.OrganizationID
+	return res
+}
+
+// lookupRole 校验组织、队列及角色，返回队列
+func (s *Server) lookupRole(params url.Values, roleName, idKey, tokenKey string, checkOrg bool) (*queue, int, string) {
+	if checkOrg && params.Get("OrganizationId") != strconv.Itoa(s.OrganizationID) {
+		return nil, retCodeAuthFailed, "Invalid organization id"
+	}
+	q, ok := s.queues[params.Get("QueueId")]
+	if !ok {
+		return nil, retCodeNotFound, "Queue not found"
+	}
+	roles := q.subs
+	if roleName == "Pub" {
+		roles = q.pubs
+	}
+	r, ok := roles[params.Get(idKey)]
+	if !ok || r.token != params.Get(tokenKey) {
+		return nil, retCodeAuthFailed, "Invalid " + idKey + " or " + tokenKey
+	}
+	return q, retCodeOK, ""
+}
+
+func (s *Server) publishMsg(params url.Values) response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, code, msg := s.lookupRole(params, "Pub", "PublisherId", "PublisherToken", true)
+	if code != retCodeOK {
+		return reply("PublishMsg", code, msg)
+	}
+	q.publish(&message{id: s.nextID("msg"), body: params.Get("Content")})
+	s.broadcast()
+	return reply("PublishMsg", retCodeOK, "")
+}
+
+func (s *Server) getMsg(params url.Values) response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, code, msg := s.lookupRole(params, "Sub", "ConsumerId", "ConsumerToken", true)
+	if code != retCodeOK {
+		return reply("GetMsg", code, msg)
+	}
+	num, err := strconv.Atoi(params.Get("Num"))
+	if err != nil || num <= 0 {
+		return reply("GetMsg", retCodeInvalidParam, "Invalid Num")
+	}
+	g := q.group(params.Get("ConsumerId"))
+	deadline := time.Now().Add(s.ackTimeout)
+	msgs := make([]umq.Message, 0, num)
+	for len(msgs) < num {
+		m := g.take(nil, deadline)
+		if m == nil {
+			break
+		}
+		q.stats.Delivered++
+		msgs = append(msgs, umq.Message{MsgId: m.id, MsgBody: m.body})
+	}
+	var stacked uint32
+	if len(g.ready) > 0 {
+		stacked = 1
+	}
+	res := reply("GetMsg", retCodeOK, "")
+	res["Data"] = umq.MessageInfo{Msgs: msgs, IsStacked: stacked}
+	return res
+}
+
+func (s *Server) ackMsg(params url.Values) response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, code, msg := s.lookupRole(params, "Sub", "ConsumerId", "ConsumerToken", false)
+	if code != retCodeOK {
+		return reply("AckMsg", code, msg)
+	}
+	g := q.group(params.Get("ConsumerId"))
+	id := params.Get("MsgId")
+	if _, ok := g.inflight[id]; !ok {
+		return reply("AckMsg", retCodeNotFound, "Message not found")
+	}
+	delete(g.inflight, id)
+	q.stats.Acked++
+	return reply("AckMsg", retCodeOK, "")
+}
+
+// connTracker 记录所有连接，以便在websocket连接被劫持之后仍能直接断开
+type connTracker struct {
+	net.Listener
+	mu    sync.Mutex
+	conns map[string]net.Conn
+}
+
+func (l *connTracker) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tc := &trackedConn{Conn: c, tracker: l}
+	l.mu.Lock()
+	l.conns[c.RemoteAddr().String()] = tc
+	l.mu.Unlock()
+	return tc, nil
+}
+
+func (l *connTracker) close(remoteAddr string) {
+	l.mu.Lock()
+	c, ok := l.conns[remoteAddr]
+	l.mu.Unlock()
+	if ok {
+		c.Close()
+	}
+}
+
+func (l *connTracker) closeAll() {
+	l.mu.Lock()
+	list := make([]net.Conn, 0, len(l.conns))
+	for _, c := range l.conns {
+		list = append(list, c)
+	}
+	l.mu.Unlock()
+	for _, c := range list {
+		c.Close()
+	}
+}
+
+type trackedConn struct {
+	net.Conn
+	tracker *connTracker
+}
+
+func (c *trackedConn) Close() error {
+	c.tracker.mu.Lock()
+	delete(c.tracker.conns, c.RemoteAddr().String())
+	c.tracker.mu.Unlock()
+	return c.Conn.Close()
+}
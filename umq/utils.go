@@ -1,13 +1,15 @@
 package umq
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strconv"
 )
 
 //获取项目ID
-func getOrganizationId(url, email, projectId, publicKey, privateKey string) (string, error) {
+func getOrganizationId(ctx context.Context, httpClient *http.Client, url, email, projectId, publicKey, privateKey string) (string, error) {
 	req := map[string]string{
 		"Action":            "GetOrganizationId",
 		"UserEmail":         email,
@@ -15,7 +17,7 @@ func getOrganizationId(url, email, projectId, publicKey, privateKey string) (str
 		"PublicKey":         publicKey,
 	}
 
-	res, err := sendUMQAPIHttpRequest(url, req, privateKey, 10)
+	res, err := sendUMQAPIHttpRequest(ctx, httpClient, url, req, privateKey, 10)
 	if err != nil {
 		return "", err
 	}
@@ -6,11 +6,13 @@ package websocket
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 // DialError is an error that occurs while dialling a websocket server.
@@ -54,6 +56,11 @@ func NewClient(config *Config, rwc io.ReadWriteCloser) (ws *Conn, err error) {
 
 // Dial opens a new client connection to a WebSocket.
 func Dial(url_, protocol, origin string) (ws *Conn, err error) {
+	return DialContext(context.Background(), url_, protocol, origin)
+}
+
+// DialContext is like Dial but aborts the connection attempt when ctx is done.
+func DialContext(ctx context.Context, url_, protocol, origin string) (ws *Conn, err error) {
 	config, err := NewConfig(url_, origin)
 	if err != nil {
 		return nil, err
@@ -61,7 +68,7 @@ func Dial(url_, protocol, origin string) (ws *Conn, err error) {
 	if protocol != "" {
 		config.Protocol = []string{protocol}
 	}
-	return DialConfig(config)
+	return config.DialContext(ctx)
 }
 
 var portMap = map[string]string{
@@ -80,34 +87,77 @@ func parseAuthority(location *url.URL) string {
 
 // DialConfig opens a new client connection to a WebSocket with a config.
 func DialConfig(config *Config) (ws *Conn, err error) {
-	var client net.Conn
+	return config.DialContext(context.Background())
+}
+
+// DialContext opens a new client connection to a WebSocket, with context support
+// for timeouts/cancellation. The context covers the TCP connect, the TLS
+// handshake and the HTTP upgrade; once the connection is established the
+// context no longer affects it.
+func (config *Config) DialContext(ctx context.Context) (*Conn, error) {
 	if config.Location == nil {
 		return nil, &DialError{config, ErrBadWebSocketLocation}
 	}
 	if config.Origin == nil {
 		return nil, &DialError{config, ErrBadWebSocketOrigin}
 	}
+	client, err := config.DialNet(ctx)
+	if err != nil {
+		return nil, &DialError{config, err}
+	}
+
+	var (
+		ws    *Conn
+		wsErr error
+	)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ws, wsErr = NewClient(config, client)
+	}()
+
+	// NewClient blocks on the HTTP upgrade, so force it to fail by expiring
+	// the connection deadline when the context is done.
+	select {
+	case <-ctx.Done():
+		client.SetDeadline(time.Now())
+		<-done
+		client.Close()
+		return nil, &DialError{config, ctx.Err()}
+	case <-done:
+		if wsErr != nil {
+			client.Close()
+			return nil, &DialError{config, wsErr}
+		}
+		return ws, nil
+	}
+}
+
+// DialNet opens the network connection to config.Location with config.Dialer,
+// over TLS for wss, without performing the WebSocket handshake. Pass the
+// connection to NewClient to complete it.
+func (config *Config) DialNet(ctx context.Context) (net.Conn, error) {
+	if config.Location == nil {
+		return nil, ErrBadWebSocketLocation
+	}
+	dialer := config.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	return dialWithDialer(ctx, dialer, config)
+}
+
+func dialWithDialer(ctx context.Context, dialer *net.Dialer, config *Config) (conn net.Conn, err error) {
 	switch config.Location.Scheme {
 	case "ws":
-		client, err = net.Dial("tcp", parseAuthority(config.Location))
+		conn, err = dialer.DialContext(ctx, "tcp", parseAuthority(config.Location))
 
 	case "wss":
-		client, err = tls.Dial("tcp", parseAuthority(config.Location), config.TlsConfig)
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: config.TlsConfig}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", parseAuthority(config.Location))
 
 	default:
 		err = ErrBadScheme
 	}
-	if err != nil {
-		goto Error
-	}
-
-	ws, err = NewClient(config, client)
-	if err != nil {
-		client.Close()
-		goto Error
-	}
 	return
-
-Error:
-	return nil, &DialError{config, err}
 }
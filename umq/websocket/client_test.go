@@ -0,0 +1,68 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// silentListener accepts TCP connections but never answers the upgrade.
+func silentListener(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, c := range conns {
+				c.Close()
+			}
+		}()
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, c)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestDialContextHandshakeTimeout(t *testing.T) {
+	addr := silentListener(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	ws, err := DialContext(ctx, "ws://"+addr+"/ws", "", "http://"+addr+"/")
+	if err == nil {
+		ws.Close()
+		t.Fatal("dial succeeded against a server that never upgrades")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("dial returned after %v", elapsed)
+	}
+	var dialErr *DialError
+	if !errors.As(err, &dialErr) || !errors.Is(dialErr.Err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DialError wrapping context.DeadlineExceeded", err)
+	}
+}
+
+func TestDialContextCancel(t *testing.T) {
+	addr := silentListener(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := DialContext(ctx, "ws://"+addr+"/ws", "", "http://"+addr+"/")
+	var dialErr *DialError
+	if !errors.As(err, &dialErr) || !errors.Is(dialErr.Err, context.Canceled) {
+		t.Fatalf("err = %v, want DialError wrapping context.Canceled", err)
+	}
+}
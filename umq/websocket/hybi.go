@@ -20,24 +20,35 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"unicode/utf8"
 )
 
 const (
 	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
 
-	closeStatusNormal            = 1000
-	closeStatusGoingAway         = 1001
-	closeStatusProtocolError     = 1002
-	closeStatusUnsupportedData   = 1003
-	closeStatusFrameTooLarge     = 1004
-	closeStatusNoStatusRcvd      = 1005
-	closeStatusAbnormalClosure   = 1006
-	closeStatusBadMessageData    = 1007
-	closeStatusPolicyViolation   = 1008
-	closeStatusTooBigData        = 1009
-	closeStatusExtensionMismatch = 1010
-
 	maxControlFramePayloadLength = 125
+	maxCloseReasonLength         = maxControlFramePayloadLength - 2
+)
+
+// MaxFramePayloadLength is the largest frame payload a Conn accepts. A peer
+// sending a larger frame fails the connection with CloseStatusTooBigData;
+// larger messages must be fragmented.
+const MaxFramePayloadLength = 32 << 20
+
+// Close status codes, as defined in RFC 6455 section 7.4.1.
+const (
+	CloseStatusNormal            = 1000
+	CloseStatusGoingAway         = 1001
+	CloseStatusProtocolError     = 1002
+	CloseStatusUnsupportedData   = 1003
+	CloseStatusFrameTooLarge     = 1004
+	CloseStatusNoStatusRcvd      = 1005
+	CloseStatusAbnormalClosure   = 1006
+	CloseStatusBadMessageData    = 1007
+	CloseStatusPolicyViolation   = 1008
+	CloseStatusTooBigData        = 1009
+	CloseStatusExtensionMismatch = 1010
 )
 
 var (
@@ -46,6 +57,9 @@ var (
 	ErrBadClosingStatus      = &ProtocolError{"bad closing status"}
 	ErrUnsupportedExtensions = &ProtocolError{"unsupported extensions"}
 	ErrNotImplemented        = &ProtocolError{"not implemented"}
+	ErrCloseReasonTooLong    = &ProtocolError{"close reason too long"}
+	ErrInvalidUTF8           = &ProtocolError{"invalid utf-8 in text message"}
+	ErrFrameTooLarge         = &ProtocolError{"frame payload exceeds limit"}
 
 	handshakeHeader = map[string]bool{
 		"Host":                   true,
@@ -67,16 +81,26 @@ type hybiFrameHeader struct {
 	Length     int64
 	MaskingKey []byte
 
-	data *bytes.Buffer
+	data []byte
 }
 
+// maxFrameHeaderLength is the size of the largest frame header: 2 bytes,
+// a 64-bit extended payload length and a masking key.
+const maxFrameHeaderLength = 2 + 8 + 4
+
 // A hybiFrameReader is a reader for hybi frame.
 type hybiFrameReader struct {
 	reader io.Reader
 
 	header hybiFrameHeader
-	pos    int64
+	pos    int
 	length int
+
+	// Backing storage for header.data, header.MaskingKey and reader, so
+	// reading a frame does not allocate.
+	headerBuf [maxFrameHeaderLength]byte
+	maskKey   [4]byte
+	limited   io.LimitedReader
 }
 
 func (frame *hybiFrameReader) Read(msg []byte) (n int, err error) {
@@ -85,10 +109,7 @@ func (frame *hybiFrameReader) Read(msg []byte) (n int, err error) {
 		return 0, err
 	}
 	if frame.header.MaskingKey != nil {
-		for i := 0; i < n; i++ {
-			msg[i] = msg[i] ^ frame.header.MaskingKey[frame.pos%4]
-			frame.pos++
-		}
+		frame.pos = maskBytes(frame.maskKey, frame.pos, msg[:n])
 	}
 	return n, err
 }
@@ -96,31 +117,34 @@ func (frame *hybiFrameReader) Read(msg []byte) (n int, err error) {
 func (frame *hybiFrameReader) PayloadType() byte { return frame.header.OpCode }
 
 func (frame *hybiFrameReader) HeaderReader() io.Reader {
-	if frame.header.data == nil {
-		return nil
-	}
-	if frame.header.data.Len() == 0 {
+	if len(frame.header.data) == 0 {
 		return nil
 	}
-	return frame.header.data
+	return bytes.NewReader(frame.header.data)
 }
 
 func (frame *hybiFrameReader) TrailerReader() io.Reader { return nil }
 
 func (frame *hybiFrameReader) Len() (n int) { return frame.length }
 
+func (frame *hybiFrameReader) Final() bool { return frame.header.Fin }
+
 // A hybiFrameReaderFactory creates new frame reader based on its frame type.
+// Only one frame is read at a time, so the factory hands out the same
+// frame reader for every frame.
 type hybiFrameReaderFactory struct {
 	*bufio.Reader
+	frame hybiFrameReader
 }
 
 // NewFrameReader reads a frame header from the connection, and creates new reader for the frame.
 // See Section 5.2 Base Framing protocol for detail.
 // http://tools.ietf.org/html/draft-ietf-hybi-thewebsocketprotocol-17#section-5.2
-func (buf hybiFrameReaderFactory) NewFrameReader() (frame frameReader, err error) {
-	hybiFrame := new(hybiFrameReader)
+func (buf *hybiFrameReaderFactory) NewFrameReader() (frame frameReader, err error) {
+	hybiFrame := &buf.frame
+	*hybiFrame = hybiFrameReader{}
 	frame = hybiFrame
-	var header []byte
+	header := hybiFrame.headerBuf[:0]
 	var b byte
 	// First byte. FIN/RSV1/RSV2/RSV3/OpCode(4bits)
 	b, err = buf.ReadByte()
@@ -157,9 +181,6 @@ func (buf hybiFrameReaderFactory) NewFrameReader() (frame frameReader, err error
 		if err != nil {
 			return
 		}
-		if lengthFields == 8 && i == 0 { // MSB must be zero when 7+64 bits
-			b &= 0x7f
-		}
 		header = append(header, b)
 		hybiFrame.header.Length = hybiFrame.header.Length*256 + int64(b)
 	}
@@ -171,11 +192,13 @@ func (buf hybiFrameReaderFactory) NewFrameReader() (frame frameReader, err error
 				return
 			}
 			header = append(header, b)
-			hybiFrame.header.MaskingKey = append(hybiFrame.header.MaskingKey, b)
+			hybiFrame.maskKey[i] = b
 		}
+		hybiFrame.header.MaskingKey = hybiFrame.maskKey[:]
 	}
-	hybiFrame.reader = io.LimitReader(buf.Reader, hybiFrame.header.Length)
-	hybiFrame.header.data = bytes.NewBuffer(header)
+	hybiFrame.limited = io.LimitedReader{R: buf.Reader, N: hybiFrame.header.Length}
+	hybiFrame.reader = &hybiFrame.limited
+	hybiFrame.header.data = header
 	hybiFrame.length = len(header) + int(hybiFrame.header.Length)
 	return
 }
@@ -188,7 +211,8 @@ type hybiFrameWriter struct {
 }
 
 func (frame *hybiFrameWriter) Write(msg []byte) (n int, err error) {
-	var header []byte
+	var headerBuf [maxFrameHeaderLength]byte
+	header := headerBuf[:0]
 	var b byte
 	if frame.header.Fin {
 		b |= 0x80
@@ -228,13 +252,21 @@ func (frame *hybiFrameWriter) Write(msg []byte) (n int, err error) {
 		if len(frame.header.MaskingKey) != 4 {
 			return 0, ErrBadMaskingKey
 		}
-		header = append(header, frame.header.MaskingKey...)
+		var key [4]byte
+		copy(key[:], frame.header.MaskingKey)
+		header = append(header, key[:]...)
 		frame.writer.Write(header)
-		data := make([]byte, length)
-		for i := range data {
-			data[i] = msg[i] ^ frame.header.MaskingKey[i%4]
+		// Mask into a pooled buffer chunk by chunk rather than
+		// allocating a copy of the whole payload.
+		bufp := maskBufPool.Get().(*[]byte)
+		data := *bufp
+		pos := 0
+		for i := 0; i < length; i += len(data) {
+			chunk := data[:copy(data, msg[i:])]
+			pos = maskBytes(key, pos, chunk)
+			frame.writer.Write(chunk)
 		}
-		frame.writer.Write(data)
+		maskBufPool.Put(bufp)
 		err = frame.writer.Flush()
 		return length, err
 	}
@@ -246,53 +278,122 @@ func (frame *hybiFrameWriter) Write(msg []byte) (n int, err error) {
 
 func (frame *hybiFrameWriter) Close() error { return nil }
 
+// maskBufPool holds scratch buffers used to mask outgoing payloads.
+var maskBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 4096)
+		return &b
+	},
+}
+
+// maskBytes applies the masking key to b, where pos is the offset of b[0]
+// within the payload modulo 4, and returns the position following b.
+// Bytes are masked eight at a time once pos is aligned to the key.
+func maskBytes(key [4]byte, pos int, b []byte) int {
+	i := 0
+	for ; i < len(b) && pos&3 != 0; i++ {
+		b[i] ^= key[pos&3]
+		pos++
+	}
+	if len(b)-i >= 8 {
+		k := uint64(binary.LittleEndian.Uint32(key[:]))
+		k |= k << 32
+		for ; len(b)-i >= 8; i += 8 {
+			binary.LittleEndian.PutUint64(b[i:], binary.LittleEndian.Uint64(b[i:])^k)
+		}
+	}
+	for ; i < len(b); i++ {
+		b[i] ^= key[pos&3]
+		pos++
+	}
+	return pos & 3
+}
+
+// A hybiFrameWriterFactory creates frame writers. Writers are used under
+// the connection's frame lock one at a time, so the factory hands out the
+// same writer for every frame.
 type hybiFrameWriterFactory struct {
 	*bufio.Writer
 	needMaskingKey bool
+
+	frame  hybiFrameWriter
+	header hybiFrameHeader
+	key    [4]byte
 }
 
-func (buf hybiFrameWriterFactory) NewFrameWriter(payloadType byte) (frame frameWriter, err error) {
-	frameHeader := &hybiFrameHeader{Fin: true, OpCode: payloadType}
+func (buf *hybiFrameWriterFactory) NewFrameWriter(payloadType byte) (frame frameWriter, err error) {
+	return buf.NewFragmentWriter(payloadType, true)
+}
+
+func (buf *hybiFrameWriterFactory) NewFragmentWriter(payloadType byte, fin bool) (frame frameWriter, err error) {
+	buf.header = hybiFrameHeader{Fin: fin, OpCode: payloadType}
 	if buf.needMaskingKey {
-		frameHeader.MaskingKey, err = generateMaskingKey()
-		if err != nil {
+		if _, err = io.ReadFull(rand.Reader, buf.key[:]); err != nil {
 			return nil, err
 		}
+		buf.header.MaskingKey = buf.key[:]
 	}
-	return &hybiFrameWriter{writer: buf.Writer, header: frameHeader}, nil
+	buf.frame = hybiFrameWriter{writer: buf.Writer, header: &buf.header}
+	return &buf.frame, nil
 }
 
 type hybiFrameHandler struct {
 	conn        *Conn
 	payloadType byte
+	inFragment  bool
+	closeSent   bool
+
+	// controlBuf receives the payload of ping, pong and close frames.
+	controlBuf [maxControlFramePayloadLength]byte
 }
 
 func (handler *hybiFrameHandler) HandleFrame(frame frameReader) (frameReader, error) {
+	header := &frame.(*hybiFrameReader).header
 	if handler.conn.IsServerConn() {
 		// The client MUST mask all frames sent to the server.
-		if frame.(*hybiFrameReader).header.MaskingKey == nil {
-			handler.WriteClose(closeStatusProtocolError)
-			return nil, io.EOF
+		if header.MaskingKey == nil {
+			return nil, handler.fail(CloseStatusProtocolError, ErrBadMaskingKey)
 		}
 	} else {
 		// The server MUST NOT mask all frames.
-		if frame.(*hybiFrameReader).header.MaskingKey != nil {
-			handler.WriteClose(closeStatusProtocolError)
-			return nil, io.EOF
+		if header.MaskingKey != nil {
+			return nil, handler.fail(CloseStatusProtocolError, ErrBadMaskingKey)
 		}
 	}
-	if header := frame.HeaderReader(); header != nil {
-		io.Copy(ioutil.Discard, header)
+	// No extension is negotiated, so RSV bits MUST be 0 (section 5.2).
+	if header.Rsv[0] || header.Rsv[1] || header.Rsv[2] {
+		return nil, handler.fail(CloseStatusProtocolError, ErrUnsupportedExtensions)
+	}
+	// The most significant bit of a 64-bit payload length MUST be 0.
+	if header.Length < 0 {
+		return nil, handler.fail(CloseStatusProtocolError, ErrBadFrame)
+	}
+	if header.Length > MaxFramePayloadLength {
+		return nil, handler.fail(CloseStatusTooBigData, ErrFrameTooLarge)
+	}
+	// Control frames MUST NOT be fragmented and carry at most 125 bytes (section 5.5).
+	if header.OpCode >= CloseFrame && (!header.Fin || header.Length > maxControlFramePayloadLength) {
+		return nil, handler.fail(CloseStatusProtocolError, ErrBadFrame)
 	}
 	switch frame.PayloadType() {
 	case ContinuationFrame:
-		frame.(*hybiFrameReader).header.OpCode = handler.payloadType
+		if !handler.inFragment {
+			return nil, handler.fail(CloseStatusProtocolError, ErrBadFrame)
+		}
+		handler.inFragment = !header.Fin
+		header.OpCode = handler.payloadType
 	case TextFrame, BinaryFrame:
+		// A new data message MUST NOT start before the previous one has
+		// been completed (section 5.4).
+		if handler.inFragment {
+			return nil, handler.fail(CloseStatusProtocolError, ErrBadFrame)
+		}
+		handler.inFragment = !header.Fin
 		handler.payloadType = frame.PayloadType()
 	case CloseFrame:
-		return nil, io.EOF
+		return nil, handler.handleClose(frame)
 	case PingFrame, PongFrame:
-		b := make([]byte, maxControlFramePayloadLength)
+		b := handler.controlBuf[:]
 		n, err := io.ReadFull(frame, b)
 		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 			return nil, err
@@ -304,27 +405,87 @@ func (handler *hybiFrameHandler) HandleFrame(frame frameReader) (frameReader, er
 			}
 		}
 		return nil, nil
+	default:
+		// Reserved opcodes.
+		return nil, handler.fail(CloseStatusProtocolError, ErrBadFrame)
 	}
 	return frame, nil
 }
 
-func (handler *hybiFrameHandler) WriteClose(status int) (err error) {
-	handler.conn.wio.Lock()
-	defer handler.conn.wio.Unlock()
+// fail sends a close frame with status to the peer and returns err.
+func (handler *hybiFrameHandler) fail(status int, err error) error {
+	handler.WriteClose(status, "")
+	return err
+}
+
+// handleClose reads the status code and reason of a received close frame,
+// echoes the status back to the peer and returns them as a *CloseError.
+func (handler *hybiFrameHandler) handleClose(frame frameReader) error {
+	b := handler.controlBuf[:]
+	n, err := io.ReadFull(frame, b)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	io.Copy(ioutil.Discard, frame)
+	closeErr := &CloseError{Code: CloseStatusNoStatusRcvd}
+	switch {
+	case n == 1:
+		return handler.fail(CloseStatusProtocolError, ErrBadClosingStatus)
+	case n >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(b[:2]))
+		closeErr.Text = string(b[2:n])
+		if !validReceivedCloseCode(closeErr.Code) {
+			return handler.fail(CloseStatusProtocolError, ErrBadClosingStatus)
+		}
+		if !utf8.ValidString(closeErr.Text) {
+			return handler.fail(CloseStatusBadMessageData, ErrInvalidUTF8)
+		}
+	}
+	if closeErr.Code == CloseStatusNoStatusRcvd {
+		handler.WriteClose(CloseStatusNormal, "")
+	} else {
+		handler.WriteClose(closeErr.Code, "")
+	}
+	return closeErr
+}
+
+// validReceivedCloseCode reports whether code may appear in a close frame
+// sent by a peer (section 7.4).
+func validReceivedCloseCode(code int) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code >= 1000 && code <= 1011:
+		return code != 1004 && code != CloseStatusNoStatusRcvd && code != CloseStatusAbnormalClosure
+	}
+	return false
+}
+
+func (handler *hybiFrameHandler) WriteClose(status int, reason string) (err error) {
+	if len(reason) > maxCloseReasonLength {
+		return ErrCloseReasonTooLong
+	}
+	handler.conn.fio.Lock()
+	defer handler.conn.fio.Unlock()
+	if handler.closeSent {
+		return nil
+	}
 	w, err := handler.conn.frameWriterFactory.NewFrameWriter(CloseFrame)
 	if err != nil {
 		return err
 	}
-	msg := make([]byte, 2)
+	msg := make([]byte, 2+len(reason))
 	binary.BigEndian.PutUint16(msg, uint16(status))
+	copy(msg[2:], reason)
 	_, err = w.Write(msg)
 	w.Close()
+	handler.closeSent = true
 	return err
 }
 
 func (handler *hybiFrameHandler) WritePong(msg []byte) (n int, err error) {
-	handler.conn.wio.Lock()
-	defer handler.conn.wio.Unlock()
+	handler.conn.fio.Lock()
+	defer handler.conn.fio.Unlock()
 	w, err := handler.conn.frameWriterFactory.NewFrameWriter(PongFrame)
 	if err != nil {
 		return 0, err
@@ -342,24 +503,15 @@ func newHybiConn(config *Config, buf *bufio.ReadWriter, rwc io.ReadWriteCloser,
 		buf = bufio.NewReadWriter(br, bw)
 	}
 	ws := &Conn{config: config, request: request, buf: buf, rwc: rwc,
-		frameReaderFactory: hybiFrameReaderFactory{buf.Reader},
-		frameWriterFactory: hybiFrameWriterFactory{
-			buf.Writer, request == nil},
+		frameReaderFactory: &hybiFrameReaderFactory{Reader: buf.Reader},
+		frameWriterFactory: &hybiFrameWriterFactory{
+			Writer: buf.Writer, needMaskingKey: request == nil},
 		PayloadType:        TextFrame,
-		defaultCloseStatus: closeStatusNormal}
+		defaultCloseStatus: CloseStatusNormal}
 	ws.frameHandler = &hybiFrameHandler{conn: ws}
 	return ws
 }
 
-// generateMaskingKey generates a masking key for a frame.
-func generateMaskingKey() (maskingKey []byte, err error) {
-	maskingKey = make([]byte, 4)
-	if _, err = io.ReadFull(rand.Reader, maskingKey); err != nil {
-		return
-	}
-	return
-}
-
 // generateNonce generates a nonce consisting of a randomly selected 16-byte
 // value that has been base64-encoded.
 func generateNonce() (nonce []byte) {
@@ -0,0 +1,117 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+var benchSizes = []int{16, 256, 4 << 10, 64 << 10}
+
+func TestMaskBytes(t *testing.T) {
+	key := [4]byte{0xa1, 0xb2, 0xc3, 0xd4}
+	for size := 0; size < 40; size++ {
+		for start := 0; start < 4; start++ {
+			b := make([]byte, size)
+			for i := range b {
+				b[i] = byte(i)
+			}
+			// Mask in two chunks to exercise positions that are not
+			// aligned to the key.
+			split := size / 3
+			pos := maskBytes(key, start, b[:split])
+			pos = maskBytes(key, pos, b[split:])
+			if want := (start + size) & 3; pos != want {
+				t.Fatalf("size %d start %d: pos = %d, want %d", size, start, pos, want)
+			}
+			for i := range b {
+				if want := byte(i) ^ key[(start+i)&3]; b[i] != want {
+					t.Fatalf("size %d start %d: b[%d] = %#x, want %#x", size, start, i, b[i], want)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkMaskBytes(b *testing.B) {
+	key := [4]byte{0xa1, 0xb2, 0xc3, 0xd4}
+	for _, size := range benchSizes {
+		for _, pos := range []int{0, 1} {
+			b.Run(fmt.Sprintf("%d/pos%d", size, pos), func(b *testing.B) {
+				data := make([]byte, size)
+				b.SetBytes(int64(size))
+				for i := 0; i < b.N; i++ {
+					maskBytes(key, pos, data)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkFrameWrite(b *testing.B) {
+	for _, masked := range []bool{false, true} {
+		for _, size := range benchSizes {
+			name := "server"
+			if masked {
+				name = "client"
+			}
+			b.Run(fmt.Sprintf("%s/%d", name, size), func(b *testing.B) {
+				factory := &hybiFrameWriterFactory{Writer: bufio.NewWriter(ioutil.Discard), needMaskingKey: masked}
+				msg := make([]byte, size)
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					w, err := factory.NewFrameWriter(BinaryFrame)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if _, err := w.Write(msg); err != nil {
+						b.Fatal(err)
+					}
+					w.Close()
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkFrameRead(b *testing.B) {
+	for _, masked := range []bool{false, true} {
+		for _, size := range benchSizes {
+			name := "client"
+			if masked {
+				name = "server"
+			}
+			b.Run(fmt.Sprintf("%s/%d", name, size), func(b *testing.B) {
+				var wire bytes.Buffer
+				bw := bufio.NewWriter(&wire)
+				w, _ := (&hybiFrameWriterFactory{Writer: bw, needMaskingKey: masked}).NewFrameWriter(BinaryFrame)
+				w.Write(make([]byte, size))
+				src := bytes.NewReader(wire.Bytes())
+				factory := &hybiFrameReaderFactory{Reader: bufio.NewReader(src)}
+				buf := make([]byte, 4096)
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					src.Seek(0, io.SeekStart)
+					factory.Reader.Reset(src)
+					frame, err := factory.NewFrameReader()
+					if err != nil {
+						b.Fatal(err)
+					}
+					n, err := io.CopyBuffer(ioutil.Discard, struct{ io.Reader }{frame}, buf)
+					if err != nil || n != int64(size) {
+						b.Fatalf("read %d bytes, err %v", n, err)
+					}
+				}
+			})
+		}
+	}
+}
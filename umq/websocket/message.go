@@ -0,0 +1,258 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"unicode/utf8"
+)
+
+// fragmentSize is the payload size of each frame sent by a message writer.
+const fragmentSize = 4096
+
+var (
+	ErrStaleReader    = errors.New("websocket: read from a stale message reader")
+	ErrWriterClosed   = errors.New("websocket: write to a closed message writer")
+	errUnexpectedCont = &ProtocolError{"unexpected continuation frame"}
+	errExpectedCont   = &ProtocolError{"expected continuation frame"}
+)
+
+// unlockedReader reads a message while the caller already holds ws.rio.
+type unlockedReader struct {
+	r *messageReader
+}
+
+func (u unlockedReader) Read(p []byte) (int, error) { return u.r.read(p) }
+
+// NextReader returns the type and a reader for the next data message received
+// from ws. The reader spans all fragments of the message and returns io.EOF
+// at its end. Control frames arriving between fragments are handled
+// transparently, and the payload of text messages is checked to be valid
+// UTF-8; an invalid message fails the connection with ErrInvalidUTF8. The reader is only valid until the next call to NextReader
+// or Receive; any unread part of the previous message is discarded.
+func (ws *Conn) NextReader() (payloadType byte, r io.Reader, err error) {
+	ws.rio.Lock()
+	defer ws.rio.Unlock()
+	mr, err := ws.nextMessage()
+	if err != nil {
+		return UnknownFrame, nil, err
+	}
+	return ws.frameReader.PayloadType(), mr, nil
+}
+
+// NextWriter returns a writer for a new message of the given payload type
+// (TextFrame or BinaryFrame). Data is sent as a sequence of fragments, the
+// last of which is written by Close. Other data writes on ws block until the
+// writer is closed, so the caller must always Close it. Pongs and close
+// frames sent while reading are written between fragments, so the same
+// goroutine may keep reading from ws while the writer is open.
+func (ws *Conn) NextWriter(payloadType byte) (io.WriteCloser, error) {
+	if payloadType != TextFrame && payloadType != BinaryFrame {
+		return nil, ErrNotSupported
+	}
+	ws.wio.Lock()
+	return &messageWriter{
+		ws:          ws,
+		payloadType: payloadType,
+		buf:         make([]byte, 0, fragmentSize),
+	}, nil
+}
+
+// nextMessage discards what is left of the current message and positions ws
+// on the first frame of the next data message. ws.rio must be held.
+func (ws *Conn) nextMessage() (*messageReader, error) {
+	if mr := ws.msgReader; mr != nil {
+		if _, err := io.Copy(ioutil.Discard, unlockedReader{mr}); err != nil {
+			return nil, err
+		}
+		mr.stale = true
+	} else if ws.frameReader != nil {
+		if _, err := io.Copy(ioutil.Discard, ws.frameReader); err != nil {
+			return nil, err
+		}
+		ws.frameReader = nil
+	}
+	frame, err := ws.nextDataFrame()
+	if err != nil {
+		return nil, err
+	}
+	ws.frameReader = frame
+	ws.msgReader = &messageReader{ws: ws, text: frame.PayloadType() == TextFrame}
+	return ws.msgReader, nil
+}
+
+// nextDataFrame reads frames until a data frame arrives, letting the frame
+// handler consume control frames and enforce fragmentation rules.
+func (ws *Conn) nextDataFrame() (frameReader, error) {
+	for {
+		frame, err := ws.frameReaderFactory.NewFrameReader()
+		if err != nil {
+			return nil, err
+		}
+		frame, err = ws.frameHandler.HandleFrame(frame)
+		if err != nil {
+			return nil, err
+		}
+		if frame != nil {
+			return frame, nil
+		}
+	}
+}
+
+// messageReader reads a single, possibly fragmented, message.
+type messageReader struct {
+	ws    *Conn
+	done  bool
+	stale bool // superseded by a later NextReader, Receive or Read
+
+	text bool
+	utf8 utf8Validator
+}
+
+func (r *messageReader) Read(p []byte) (int, error) {
+	r.ws.rio.Lock()
+	defer r.ws.rio.Unlock()
+	if r.stale {
+		return 0, ErrStaleReader
+	}
+	return r.read(p)
+}
+
+// read is Read without locking; ws.rio must be held.
+func (r *messageReader) read(p []byte) (int, error) {
+	ws := r.ws
+	if r.done {
+		return 0, io.EOF
+	}
+	if ws.frameReader == nil {
+		return 0, ErrStaleReader
+	}
+	for {
+		n, err := ws.frameReader.Read(p)
+		if r.text && !r.utf8.valid(p[:n], false) {
+			return 0, r.failUTF8()
+		}
+		if err != io.EOF {
+			return n, err
+		}
+		final := ws.frameReader.Final()
+		ws.frameReader = nil
+		if final {
+			r.done = true
+			ws.msgReader = nil
+			if r.text && !r.utf8.valid(nil, true) {
+				return 0, r.failUTF8()
+			}
+			return n, io.EOF
+		}
+		frame, err := ws.nextDataFrame()
+		if err != nil {
+			return n, err
+		}
+		ws.frameReader = frame
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (r *messageReader) failUTF8() error {
+	r.done = true
+	r.ws.msgReader = nil
+	r.ws.frameReader = nil
+	r.ws.frameHandler.WriteClose(CloseStatusBadMessageData, "")
+	return ErrInvalidUTF8
+}
+
+// utf8Validator checks a text message for valid UTF-8 incrementally, since
+// a code point may be split across reads or fragments.
+type utf8Validator struct {
+	pending []byte
+}
+
+// valid reports whether p, prefixed by any incomplete sequence left from the
+// previous call, is valid UTF-8. Unless final is set, an incomplete sequence
+// at the end of p is kept for the next call.
+func (v *utf8Validator) valid(p []byte, final bool) bool {
+	data := p
+	if len(v.pending) > 0 {
+		data = append(v.pending, p...)
+	}
+	i := 0
+	for i < len(data) {
+		if data[i] < utf8.RuneSelf {
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			if !final && !utf8.FullRune(data[i:]) {
+				break
+			}
+			return false
+		}
+		i += size
+	}
+	v.pending = append(v.pending[:0], data[i:]...)
+	return true
+}
+
+// messageWriter writes a single message as a sequence of fragments.
+type messageWriter struct {
+	ws          *Conn
+	payloadType byte
+	buf         []byte
+	started     bool
+	closed      bool
+}
+
+func (w *messageWriter) Write(p []byte) (n int, err error) {
+	if w.closed {
+		return 0, ErrWriterClosed
+	}
+	for len(p) > 0 {
+		if len(w.buf) == cap(w.buf) {
+			if err = w.flush(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		n += m
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// Close sends the final fragment and releases the connection for other writers.
+func (w *messageWriter) Close() error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	err := w.flush(true)
+	w.closed = true
+	w.ws.wio.Unlock()
+	return err
+}
+
+func (w *messageWriter) flush(fin bool) error {
+	payloadType := byte(ContinuationFrame)
+	if !w.started {
+		payloadType = w.payloadType
+	}
+	w.ws.fio.Lock()
+	defer w.ws.fio.Unlock()
+	fw, err := w.ws.frameWriterFactory.NewFragmentWriter(payloadType, fin)
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(w.buf)
+	fw.Close()
+	w.started = true
+	w.buf = w.buf[:0]
+	return err
+}
@@ -0,0 +1,182 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serve starts a Server running handler and returns its address.
+func serve(t *testing.T, handler Handler) string {
+	srv := httptest.NewServer(Server{Handler: handler})
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func TestNextReaderFragmented(t *testing.T) {
+	type result struct {
+		payloadType byte
+		data        string
+		err         error
+	}
+	got := make(chan result, 1)
+	addr := serve(t, func(ws *Conn) {
+		payloadType, r, err := ws.NextReader()
+		if err != nil {
+			got <- result{err: err}
+			return
+		}
+		// Read in small pieces so reads cross fragment boundaries.
+		var data bytes.Buffer
+		_, err = io.CopyBuffer(&data, struct{ io.Reader }{r}, make([]byte, 3))
+		got <- result{payloadType, data.String(), err}
+		ws.NextReader()
+	})
+	c := dialRaw(t, addr)
+	c.send(
+		frame(TextFrame, []byte("Hel")),
+		frame(finBit|PingFrame, []byte("x")),
+		frame(ContinuationFrame, []byte("lo, ")),
+		frame(finBit|ContinuationFrame, []byte("world")),
+	)
+	if b0, payload := c.next(); b0 != finBit|PongFrame || string(payload) != "x" {
+		t.Errorf("reply to ping = %#x %q, want pong %q", b0, payload, "x")
+	}
+	select {
+	case r := <-got:
+		if r.err != nil || r.payloadType != TextFrame || r.data != "Hello, world" {
+			t.Errorf("NextReader = %d %q %v, want text %q", r.payloadType, r.data, r.err, "Hello, world")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+}
+
+func TestNextReaderStale(t *testing.T) {
+	errc := make(chan error, 1)
+	ws := dialServer(t, func(ws *Conn) {
+		errc <- func() error {
+			_, r1, err := ws.NextReader()
+			if err != nil {
+				return err
+			}
+			var b [2]byte
+			if _, err := io.ReadFull(r1, b[:]); err != nil {
+				return err
+			}
+			_, r2, err := ws.NextReader()
+			if err != nil {
+				return err
+			}
+			if n, err := r1.Read(b[:]); err != ErrStaleReader {
+				t.Errorf("stale reader returned %d, %v, want ErrStaleReader", n, err)
+			}
+			data, err := io.ReadAll(r2)
+			if string(data) != "second" {
+				// The unread rest of the first message must be discarded.
+				t.Errorf("second message = %q", data)
+			}
+			return err
+		}()
+	})
+	Message.Send(ws, "first message")
+	Message.Send(ws, "second")
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+}
+
+func TestNextWriterAfterClose(t *testing.T) {
+	ws := dialServer(t, func(ws *Conn) {
+		for {
+			var msg string
+			if err := Message.Receive(ws, &msg); err != nil {
+				return
+			}
+			Message.Send(ws, msg)
+		}
+	})
+	w, err := ws.NextWriter(TextFrame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "hello")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("late")); err != ErrWriterClosed {
+		t.Errorf("Write after Close = %v, want ErrWriterClosed", err)
+	}
+	if err := w.Close(); err != ErrWriterClosed {
+		t.Errorf("second Close = %v, want ErrWriterClosed", err)
+	}
+	// The closed writer released the connection for other writers.
+	if err := Message.Send(ws, "next"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"hello", "next"} {
+		var msg string
+		if err := Message.Receive(ws, &msg); err != nil || msg != want {
+			t.Fatalf("Receive = %q, %v, want %q", msg, err, want)
+		}
+	}
+	if _, err := ws.NextWriter(PingFrame); err != ErrNotSupported {
+		t.Errorf("NextWriter(PingFrame) = %v, want ErrNotSupported", err)
+	}
+}
+
+// A goroutine holding an open NextWriter must still be able to read: pongs
+// for pings received meanwhile go out between the fragments.
+func TestNextWriterWhileReading(t *testing.T) {
+	const head = fragmentSize + 100
+	errc := make(chan error, 1)
+	addr := serve(t, func(ws *Conn) {
+		errc <- func() error {
+			w, err := ws.NextWriter(TextFrame)
+			if err != nil {
+				return err
+			}
+			// Fills one fragment, which is flushed, and starts the next.
+			w.Write(bytes.Repeat([]byte("a"), head))
+			var msg string
+			if err := Message.Receive(ws, &msg); err != nil {
+				return err
+			}
+			io.WriteString(w, msg)
+			return w.Close()
+		}()
+	})
+	c := dialRaw(t, addr)
+	c.send(frame(finBit|PingFrame, []byte("p")), frame(finBit|TextFrame, []byte("tail")))
+
+	if b0, payload := c.next(); b0 != TextFrame || len(payload) != fragmentSize {
+		t.Fatalf("first frame = %#x with %d bytes, want unfinished text fragment of %d", b0, len(payload), fragmentSize)
+	}
+	if b0, payload := c.next(); b0 != finBit|PongFrame || string(payload) != "p" {
+		t.Fatalf("second frame = %#x %q, want pong", b0, payload)
+	}
+	b0, payload := c.next()
+	if want := strings.Repeat("a", head-fragmentSize) + "tail"; b0 != finBit|ContinuationFrame || string(payload) != want {
+		t.Fatalf("last frame = %#x %q, want final continuation %q", b0, payload, want)
+	}
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server deadlocked")
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoServer starts a Server that echoes every data message back and
+// reports the error that ended the connection on the returned channel.
+func echoServer(t *testing.T) (addr string, errc <-chan error) {
+	ch := make(chan error, 1)
+	srv := httptest.NewServer(Server{Handler: func(ws *Conn) {
+		for {
+			payloadType, r, err := ws.NextReader()
+			if err != nil {
+				ch <- err
+				return
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				ch <- err
+				return
+			}
+			w, err := ws.NextWriter(payloadType)
+			if err != nil {
+				ch <- err
+				return
+			}
+			w.Write(data)
+			if err = w.Close(); err != nil {
+				ch <- err
+				return
+			}
+		}
+	}})
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://"), ch
+}
+
+// rawClient is a client that writes frames byte by byte, so it can send
+// frames the Conn itself would never produce.
+type rawClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dialRaw(t *testing.T, addr string) *rawClient {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	req := "GET / HTTP/1.1\r\n" +
+		"Host: " + addr + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := io.WriteString(conn, req); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status = %d", resp.StatusCode)
+	}
+	return &rawClient{t: t, conn: conn, br: br}
+}
+
+const (
+	finBit  = 0x80
+	rsv1Bit = 0x40
+	rsv2Bit = 0x20
+	rsv3Bit = 0x10
+)
+
+// frame encodes a masked frame with the given first byte and payload.
+func frame(b0 byte, payload []byte) []byte {
+	key := [4]byte{0x12, 0x34, 0x56, 0x78}
+	buf := []byte{b0}
+	switch n := len(payload); {
+	case n <= 125:
+		buf = append(buf, 0x80|byte(n))
+	case n < 65536:
+		buf = append(buf, 0x80|126, byte(n>>8), byte(n))
+	default:
+		buf = append(buf, 0x80|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+	buf = append(buf, key[:]...)
+	masked := append([]byte(nil), payload...)
+	maskBytes(key, 0, masked)
+	return append(buf, masked...)
+}
+
+func closePayload(code int, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...)
+}
+
+func (c *rawClient) send(frames ...[]byte) {
+	for _, f := range frames {
+		if _, err := c.conn.Write(f); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+// next reads an unmasked frame sent by the server.
+func (c *rawClient) next() (b0 byte, payload []byte) {
+	var h [2]byte
+	if _, err := io.ReadFull(c.br, h[:]); err != nil {
+		c.t.Fatalf("read frame: %v", err)
+	}
+	if h[1]&0x80 != 0 {
+		c.t.Fatal("server sent a masked frame")
+	}
+	n := uint64(h[1] & 0x7f)
+	switch n {
+	case 126:
+		var l [2]byte
+		io.ReadFull(c.br, l[:])
+		n = uint64(binary.BigEndian.Uint16(l[:]))
+	case 127:
+		var l [8]byte
+		io.ReadFull(c.br, l[:])
+		n = binary.BigEndian.Uint64(l[:])
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		c.t.Fatalf("read payload: %v", err)
+	}
+	return h[0], payload
+}
+
+// closeCode skips data and control frames until the server's close frame
+// and returns its status code.
+func (c *rawClient) closeCode() int {
+	for {
+		b0, payload := c.next()
+		if b0&0x0f != CloseFrame {
+			continue
+		}
+		if b0&finBit == 0 {
+			c.t.Fatal("fragmented close frame")
+		}
+		if len(payload) < 2 {
+			return CloseStatusNoStatusRcvd
+		}
+		return int(binary.BigEndian.Uint16(payload))
+	}
+}
+
+func TestServerRejectsProtocolViolations(t *testing.T) {
+	longLength := []byte{finBit | TextFrame, 0x80 | 127, 0x80, 0, 0, 0, 0, 0, 0, 1, 1, 2, 3, 4}
+	tooLarge := binary.BigEndian.AppendUint64([]byte{finBit | BinaryFrame, 0x80 | 127}, MaxFramePayloadLength+1)
+	tooLarge = append(tooLarge, 1, 2, 3, 4)
+	tests := []struct {
+		name   string
+		frames [][]byte
+		status int
+	}{
+		{"rsv1", [][]byte{frame(finBit|rsv1Bit|TextFrame, []byte("a"))}, CloseStatusProtocolError},
+		{"rsv2", [][]byte{frame(finBit|rsv2Bit|BinaryFrame, []byte("a"))}, CloseStatusProtocolError},
+		{"rsv3 on ping", [][]byte{frame(finBit|rsv3Bit|PingFrame, nil)}, CloseStatusProtocolError},
+		{"reserved data opcode", [][]byte{frame(finBit|0x3, []byte("a"))}, CloseStatusProtocolError},
+		{"reserved data opcode 7", [][]byte{frame(finBit|0x7, nil)}, CloseStatusProtocolError},
+		{"reserved control opcode", [][]byte{frame(finBit|0xb, nil)}, CloseStatusProtocolError},
+		{"reserved control opcode 15", [][]byte{frame(finBit|0xf, []byte("a"))}, CloseStatusProtocolError},
+		{"unmasked frame", [][]byte{{finBit | TextFrame, 1, 'a'}}, CloseStatusProtocolError},
+		{"64-bit length msb", [][]byte{longLength}, CloseStatusProtocolError},
+		{"frame too large", [][]byte{tooLarge}, CloseStatusTooBigData},
+		{"fragmented ping", [][]byte{frame(PingFrame, []byte("a")), frame(finBit|ContinuationFrame, []byte("b"))}, CloseStatusProtocolError},
+		{"fragmented close", [][]byte{frame(CloseFrame, closePayload(CloseStatusNormal, ""))}, CloseStatusProtocolError},
+		{"oversized ping", [][]byte{frame(finBit|PingFrame, bytes.Repeat([]byte("a"), 126))}, CloseStatusProtocolError},
+		{"oversized pong", [][]byte{frame(finBit|PongFrame, bytes.Repeat([]byte("a"), 200))}, CloseStatusProtocolError},
+		{"oversized close", [][]byte{frame(finBit|CloseFrame, closePayload(CloseStatusNormal, strings.Repeat("a", 124)))}, CloseStatusProtocolError},
+		{"continuation without start", [][]byte{frame(finBit|ContinuationFrame, []byte("a"))}, CloseStatusProtocolError},
+		{"continuation after final", [][]byte{frame(finBit|TextFrame, []byte("a")), frame(finBit|ContinuationFrame, []byte("b"))}, CloseStatusProtocolError},
+		{"text inside fragmented message", [][]byte{frame(TextFrame, []byte("a")), frame(finBit|TextFrame, []byte("b"))}, CloseStatusProtocolError},
+		{"binary inside fragmented message", [][]byte{frame(BinaryFrame, []byte("a")), frame(BinaryFrame, []byte("b"))}, CloseStatusProtocolError},
+		{"close with one byte", [][]byte{frame(finBit|CloseFrame, []byte{0x03})}, CloseStatusProtocolError},
+		{"close code 0", [][]byte{frame(finBit|CloseFrame, closePayload(0, ""))}, CloseStatusProtocolError},
+		{"close code 999", [][]byte{frame(finBit|CloseFrame, closePayload(999, ""))}, CloseStatusProtocolError},
+		{"close code 1004", [][]byte{frame(finBit|CloseFrame, closePayload(1004, ""))}, CloseStatusProtocolError},
+		{"close code 1005", [][]byte{frame(finBit|CloseFrame, closePayload(CloseStatusNoStatusRcvd, ""))}, CloseStatusProtocolError},
+		{"close code 1006", [][]byte{frame(finBit|CloseFrame, closePayload(CloseStatusAbnormalClosure, ""))}, CloseStatusProtocolError},
+		{"close code 1012", [][]byte{frame(finBit|CloseFrame, closePayload(1012, ""))}, CloseStatusProtocolError},
+		{"close code 2999", [][]byte{frame(finBit|CloseFrame, closePayload(2999, ""))}, CloseStatusProtocolError},
+		{"close code 5000", [][]byte{frame(finBit|CloseFrame, closePayload(5000, ""))}, CloseStatusProtocolError},
+		{"close reason invalid utf-8", [][]byte{frame(finBit|CloseFrame, closePayload(CloseStatusNormal, "\xce\xba\xe1\xbd\xb9\xcf\x83\xce\xbc\xce\xb5\xed\xa0\x80"))}, CloseStatusBadMessageData},
+		{"text invalid utf-8", [][]byte{frame(finBit|TextFrame, []byte("\xce\xba\xe1\xbd\xb9\xcf\x83\xce\xbc\xce\xb5\xed\xa0\x80"))}, CloseStatusBadMessageData},
+		{"text invalid byte", [][]byte{frame(finBit|TextFrame, []byte{'a', 0xff})}, CloseStatusBadMessageData},
+		{"text truncated code point", [][]byte{frame(finBit|TextFrame, []byte{'a', 0xe2, 0x82})}, CloseStatusBadMessageData},
+		{"fragmented text truncated code point", [][]byte{frame(TextFrame, []byte{0xe2}), frame(finBit|ContinuationFrame, []byte{0x82})}, CloseStatusBadMessageData},
+		{"fragmented text invalid continuation", [][]byte{frame(TextFrame, []byte{0xe2, 0x82}), frame(finBit|ContinuationFrame, []byte{'a'})}, CloseStatusBadMessageData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, errc := echoServer(t)
+			c := dialRaw(t, addr)
+			c.send(tt.frames...)
+			if got := c.closeCode(); got != tt.status {
+				t.Errorf("close status = %d, want %d", got, tt.status)
+			}
+			select {
+			case err := <-errc:
+				if err == nil {
+					t.Error("handler did not fail")
+				}
+			case <-time.After(5 * time.Second):
+				t.Error("handler did not return")
+			}
+		})
+	}
+}
+
+func TestServerAcceptsValidFrames(t *testing.T) {
+	addr, _ := echoServer(t)
+	c := dialRaw(t, addr)
+
+	// A ping between fragments is answered before the message completes,
+	// and a code point split across fragments is valid UTF-8.
+	euro := []byte("\xe2\x82\xac")
+	c.send(
+		frame(TextFrame, append([]byte("price "), euro[:1]...)),
+		frame(finBit|PingFrame, []byte("ping")),
+		frame(ContinuationFrame, euro[1:2]),
+		frame(finBit|ContinuationFrame, append(euro[2:], " 5"...)),
+	)
+	b0, payload := c.next()
+	if b0 != finBit|PongFrame || string(payload) != "ping" {
+		t.Fatalf("got frame %#x %q, want pong %q", b0, payload, "ping")
+	}
+	b0, payload = c.next()
+	if b0 != finBit|TextFrame || string(payload) != "price € 5" {
+		t.Fatalf("got frame %#x %q, want text %q", b0, payload, "price € 5")
+	}
+
+	// Empty fragments and binary payloads with invalid UTF-8.
+	c.send(
+		frame(BinaryFrame, nil),
+		frame(ContinuationFrame, []byte{0xff}),
+		frame(finBit|ContinuationFrame, []byte{0xfe}),
+	)
+	b0, payload = c.next()
+	if b0 != finBit|BinaryFrame || !bytes.Equal(payload, []byte{0xff, 0xfe}) {
+		t.Fatalf("got frame %#x %x, want binary fffe", b0, payload)
+	}
+
+	// Control frames of exactly 125 bytes and unsolicited pongs.
+	c.send(frame(finBit|PongFrame, nil), frame(finBit|PingFrame, bytes.Repeat([]byte("p"), 125)))
+	b0, payload = c.next()
+	if b0 != finBit|PongFrame || len(payload) != 125 {
+		t.Fatalf("got frame %#x of %d bytes, want pong of 125", b0, len(payload))
+	}
+}
+
+func TestServerEchoesValidCloseCodes(t *testing.T) {
+	tests := []struct {
+		payload []byte
+		status  int
+	}{
+		{nil, CloseStatusNormal},
+		{closePayload(CloseStatusNormal, ""), CloseStatusNormal},
+		{closePayload(CloseStatusGoingAway, "bye"), CloseStatusGoingAway},
+		{closePayload(CloseStatusBadMessageData, "κόσμε"), CloseStatusBadMessageData},
+		{closePayload(1011, ""), 1011},
+		{closePayload(3000, ""), 3000},
+		{closePayload(4999, strings.Repeat("a", maxCloseReasonLength)), 4999},
+	}
+	for _, tt := range tests {
+		addr, errc := echoServer(t)
+		c := dialRaw(t, addr)
+		c.send(frame(finBit|CloseFrame, tt.payload))
+		if got := c.closeCode(); got != tt.status {
+			t.Errorf("close %x: echoed status = %d, want %d", tt.payload, got, tt.status)
+		}
+		err := <-errc
+		want := tt.status
+		if tt.payload == nil {
+			want = CloseStatusNoStatusRcvd
+		}
+		if ce, ok := err.(*CloseError); !ok || ce.Code != want {
+			t.Errorf("close %x: handler error = %v, want CloseError %d", tt.payload, err, want)
+		}
+	}
+}
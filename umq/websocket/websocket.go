@@ -8,6 +8,7 @@ package websocket
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
@@ -16,6 +17,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -41,6 +43,21 @@ type ProtocolError struct {
 
 func (err *ProtocolError) Error() string { return err.ErrorString }
 
+// CloseError is returned by Read and Receive when the peer closed the
+// connection with a close frame. Code is CloseStatusNoStatusRcvd when the
+// close frame carried no status.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (err *CloseError) Error() string {
+	if err.Text == "" {
+		return "websocket: close " + strconv.Itoa(err.Code)
+	}
+	return "websocket: close " + strconv.Itoa(err.Code) + ": " + err.Text
+}
+
 var (
 	ErrBadProtocolVersion   = &ProtocolError{"bad protocol version"}
 	ErrBadScheme            = &ProtocolError{"bad scheme"}
@@ -86,6 +103,10 @@ type Config struct {
 	// Additional header fields to be sent in WebSocket opening handshake.
 	Header http.Header
 
+	// Dialer used when opening websocket connections. If nil, a zero
+	// net.Dialer is used.
+	Dialer *net.Dialer
+
 	handshakeData map[string]string
 }
 
@@ -120,6 +141,9 @@ type frameReader interface {
 
 	// Len returns total length of the frame, including header and trailer.
 	Len() int
+
+	// Final reports whether the frame is the last fragment of a message.
+	Final() bool
 }
 
 // frameReaderFactory is an interface to creates new frame reader.
@@ -136,11 +160,15 @@ type frameWriter interface {
 // frameWriterFactory is an interface to create new frame writer.
 type frameWriterFactory interface {
 	NewFrameWriter(payloadType byte) (w frameWriter, err error)
+
+	// NewFragmentWriter creates a writer for a single fragment of a message.
+	// payloadType is ContinuationFrame for all but the first fragment.
+	NewFragmentWriter(payloadType byte, fin bool) (w frameWriter, err error)
 }
 
 type frameHandler interface {
 	HandleFrame(frame frameReader) (r frameReader, err error)
-	WriteClose(status int) (err error)
+	WriteClose(status int, reason string) (err error)
 }
 
 // Conn represents a WebSocket connection.
@@ -154,8 +182,13 @@ type Conn struct {
 	rio sync.Mutex
 	frameReaderFactory
 	frameReader
+	msgReader *messageReader
 
+	// wio serializes data messages, and is held by a NextWriter until it is
+	// closed. fio serializes single frames, so control frames written from
+	// the read path can go out between the fragments of a message.
 	wio sync.Mutex
+	fio sync.Mutex
 	frameWriterFactory
 
 	frameHandler
@@ -171,6 +204,10 @@ type Conn struct {
 func (ws *Conn) Read(msg []byte) (n int, err error) {
 	ws.rio.Lock()
 	defer ws.rio.Unlock()
+	if ws.msgReader != nil {
+		ws.msgReader.stale = true
+		ws.msgReader = nil
+	}
 again:
 	if ws.frameReader == nil {
 		frame, err := ws.frameReaderFactory.NewFrameReader()
@@ -201,6 +238,8 @@ again:
 func (ws *Conn) Write(msg []byte) (n int, err error) {
 	ws.wio.Lock()
 	defer ws.wio.Unlock()
+	ws.fio.Lock()
+	defer ws.fio.Unlock()
 	w, err := ws.frameWriterFactory.NewFrameWriter(ws.PayloadType)
 	if err != nil {
 		return 0, err
@@ -215,7 +254,16 @@ func (ws *Conn) Write(msg []byte) (n int, err error) {
 
 // Close implements the io.Closer interface.
 func (ws *Conn) Close() error {
-	err := ws.frameHandler.WriteClose(ws.defaultCloseStatus)
+	return ws.CloseWithReason(ws.defaultCloseStatus, "")
+}
+
+// CloseWithReason sends a close frame carrying the status code and reason,
+// then closes the underlying connection. The reason must not exceed 123 bytes.
+func (ws *Conn) CloseWithReason(code int, reason string) error {
+	err := ws.frameHandler.WriteClose(code, reason)
+	if err == ErrCloseReasonTooLong {
+		return err
+	}
 	err1 := ws.rwc.Close()
 	if err != nil {
 		return err
@@ -281,6 +329,10 @@ func (ws *Conn) Request() *http.Request { return ws.request }
 type Codec struct {
 	Marshal   func(v interface{}) (data []byte, payloadType byte, err error)
 	Unmarshal func(data []byte, payloadType byte, v interface{}) (err error)
+
+	// copies is set for Message and JSON, whose Unmarshal never retains
+	// data, so Receive may pass them a pooled buffer.
+	copies bool
 }
 
 // Send sends v marshaled by cd.Marshal as single frame to ws.
@@ -291,6 +343,8 @@ func (cd Codec) Send(ws *Conn, v interface{}) (err error) {
 	}
 	ws.wio.Lock()
 	defer ws.wio.Unlock()
+	ws.fio.Lock()
+	defer ws.fio.Unlock()
 	w, err := ws.frameWriterFactory.NewFrameWriter(payloadType)
 	if err != nil {
 		return err
@@ -300,35 +354,47 @@ func (cd Codec) Send(ws *Conn, v interface{}) (err error) {
 	return err
 }
 
-// Receive receives single frame from ws, unmarshaled by cd.Unmarshal and stores in v.
+// Receive receives a single message from ws, unmarshaled by cd.Unmarshal and stores in v.
+// Fragmented messages are reassembled before being unmarshaled.
 func (cd Codec) Receive(ws *Conn, v interface{}) (err error) {
 	ws.rio.Lock()
 	defer ws.rio.Unlock()
-	if ws.frameReader != nil {
-		_, err = io.Copy(ioutil.Discard, ws.frameReader)
+	r, err := ws.nextMessage()
+	if err != nil {
+		return err
+	}
+	payloadType := ws.frameReader.PayloadType()
+	if !cd.copies {
+		// User codecs may keep data, so they get a buffer of their own.
+		data, err := ioutil.ReadAll(unlockedReader{r})
 		if err != nil {
 			return err
 		}
-		ws.frameReader = nil
-	}
-again:
-	frame, err := ws.frameReaderFactory.NewFrameReader()
-	if err != nil {
-		return err
+		return cd.Unmarshal(data, payloadType, v)
 	}
-	frame, err = ws.frameHandler.HandleFrame(frame)
-	if err != nil {
+	buf := receiveBufPool.Get().(*bytes.Buffer)
+	defer putReceiveBuf(buf)
+	buf.Reset()
+	if _, err = buf.ReadFrom(unlockedReader{r}); err != nil {
 		return err
 	}
-	if frame == nil {
-		goto again
-	}
-	payloadType := frame.PayloadType()
-	data, err := ioutil.ReadAll(frame)
-	if err != nil {
-		return err
+	// The built-in codecs copy what they keep, so the buffer can be reused.
+	return cd.Unmarshal(buf.Bytes(), payloadType, v)
+}
+
+// maxPooledReceiveBuf is the largest buffer kept in receiveBufPool, so a
+// single large message does not pin its buffer for the life of the process.
+const maxPooledReceiveBuf = 64 << 10
+
+// receiveBufPool holds buffers used by Codec.Receive to assemble messages.
+var receiveBufPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func putReceiveBuf(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledReceiveBuf {
+		receiveBufPool.Put(buf)
 	}
-	return cd.Unmarshal(data, payloadType, v)
 }
 
 func marshal(v interface{}) (msg []byte, payloadType byte, err error) {
@@ -347,7 +413,9 @@ func unmarshal(msg []byte, payloadType byte, v interface{}) (err error) {
 		*data = string(msg)
 		return nil
 	case *[]byte:
-		*data = msg
+		// msg may be reused by the caller, and callers may keep the
+		// slice from an earlier Receive, so always hand out a new copy.
+		*data = append([]byte(nil), msg...)
 		return nil
 	}
 	return ErrNotSupported
@@ -379,7 +447,7 @@ Trivial usage:
 	websocket.Message.Send(ws, data)
 
 */
-var Message = Codec{marshal, unmarshal}
+var Message = Codec{Marshal: marshal, Unmarshal: unmarshal, copies: true}
 
 func jsonMarshal(v interface{}) (msg []byte, payloadType byte, err error) {
 	msg, err = json.Marshal(v)
@@ -409,4 +477,4 @@ Trivial usage:
 	// send JSON type T
 	websocket.JSON.Send(ws, data)
 */
-var JSON = Codec{jsonMarshal, jsonUnmarshal}
+var JSON = Codec{Marshal: jsonMarshal, Unmarshal: jsonUnmarshal, copies: true}
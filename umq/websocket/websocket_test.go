@@ -0,0 +1,132 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// dialServer starts a Server running handler and returns a client connected to it.
+func dialServer(t *testing.T, handler Handler) *Conn {
+	srv := httptest.NewServer(Server{Handler: handler})
+	t.Cleanup(srv.Close)
+	ws, err := Dial("ws"+strings.TrimPrefix(srv.URL, "http"), "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func TestReceiveUserCodecMayRetainData(t *testing.T) {
+	msgs := [][]byte{bytes.Repeat([]byte("a"), 100), bytes.Repeat([]byte("b"), 100)}
+	ws := dialServer(t, func(ws *Conn) {
+		for _, msg := range msgs {
+			Message.Send(ws, msg)
+		}
+		Message.Receive(ws, new(string))
+	})
+	// A codec that keeps data instead of copying it.
+	var kept [][]byte
+	retain := Codec{Marshal: marshal, Unmarshal: func(data []byte, _ byte, _ interface{}) error {
+		kept = append(kept, data)
+		return nil
+	}}
+	for range msgs {
+		if err := retain.Receive(ws, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, msg := range msgs {
+		if !bytes.Equal(kept[i], msg) {
+			t.Errorf("message %d changed after a later Receive: %.10q...", i, kept[i])
+		}
+	}
+}
+
+func TestReceiveDoesNotPoolLargeBuffers(t *testing.T) {
+	large := bytes.Repeat([]byte("x"), 4*maxPooledReceiveBuf)
+	ws := dialServer(t, func(ws *Conn) {
+		Message.Send(ws, large)
+		Message.Receive(ws, new(string))
+	})
+	var data []byte
+	if err := Message.Receive(ws, &data); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, large) {
+		t.Fatal("large message corrupted")
+	}
+	// sync.Pool may drop entries at any time, so only check that nothing
+	// oversized comes back out of it.
+	for i := 0; i < 4; i++ {
+		buf := receiveBufPool.Get().(*bytes.Buffer)
+		if buf.Cap() > maxPooledReceiveBuf {
+			t.Fatalf("pooled buffer of %d bytes", buf.Cap())
+		}
+	}
+}
+
+func TestCodecCopies(t *testing.T) {
+	if !Message.copies || !JSON.copies {
+		t.Error("Message and JSON should be marked as copying codecs")
+	}
+	// A codec built from the same functions is a user codec and gets a
+	// buffer of its own.
+	if (Codec{Marshal: Message.Marshal, Unmarshal: Message.Unmarshal}).copies {
+		t.Error("user codec marked as copying")
+	}
+}
+
+func TestReceiveBytesKeepsEarlierSlices(t *testing.T) {
+	ws := dialServer(t, func(ws *Conn) {
+		Message.Send(ws, []byte("aaaa"))
+		Message.Send(ws, []byte("bbbb"))
+		Message.Receive(ws, new(string))
+	})
+	var b []byte
+	if err := Message.Receive(ws, &b); err != nil {
+		t.Fatal(err)
+	}
+	a := b
+	if err := Message.Receive(ws, &b); err != nil {
+		t.Fatal(err)
+	}
+	if string(a) != "aaaa" || string(b) != "bbbb" {
+		t.Errorf("after two receives a = %q, b = %q, want \"aaaa\", \"bbbb\"", a, b)
+	}
+}
+
+func TestCloseWithReason(t *testing.T) {
+	reason := strings.Repeat("r", maxCloseReasonLength)
+	tooLong := make(chan error, 1)
+	ws := dialServer(t, func(ws *Conn) {
+		tooLong <- ws.CloseWithReason(4000, reason+"r")
+		// A rejected reason must leave the connection open.
+		Message.Send(ws, "still open")
+		ws.CloseWithReason(4000, reason)
+	})
+	var msg string
+	if err := Message.Receive(ws, &msg); err != nil || msg != "still open" {
+		t.Fatalf("Receive = %q, %v", msg, err)
+	}
+	if err := <-tooLong; err != ErrCloseReasonTooLong {
+		t.Fatalf("CloseWithReason with %d byte reason: %v, want ErrCloseReasonTooLong", len(reason)+1, err)
+	}
+	err := Message.Receive(ws, &msg)
+	closeErr, ok := err.(*CloseError)
+	if !ok {
+		t.Fatalf("Receive after close: %v, want *CloseError", err)
+	}
+	if closeErr.Code != 4000 || closeErr.Text != reason {
+		t.Errorf("CloseError = %d %q, want 4000 %q", closeErr.Code, closeErr.Text, reason)
+	}
+	if want := "websocket: close 4000: " + reason; closeErr.Error() != want {
+		t.Errorf("Error() = %q", closeErr.Error())
+	}
+}